@@ -1,31 +1,127 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	C    = new(Config)
-	once sync.Once
+	C       = new(Config)
+	once    sync.Once
+	loadErr error
 )
 
 func MustLoad(path string) {
+	if err := Load(path); err != nil {
+		panic(err)
+	}
+}
+
+// Load reads the config file into C once and reports unknown keys and
+// invalid values of YAML and JSON files.
+func Load(path string) error {
 	once.Do(func() {
-		viper.SetConfigFile(path)
-		err := viper.ReadInConfig()
+		loadErr = load(path)
+	})
+	return loadErr
+}
+
+func load(path string) error {
+	// viper lowercases keys, so typos are caught on the raw document
+	var raw []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		data, err := os.ReadFile(path)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		err = viper.Unmarshal(&C)
-		if err != nil {
-			panic(err)
+		if err := Validate(data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
 		}
+		raw = data
+	}
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+	if err := viper.Unmarshal(&C); err != nil {
+		return err
+	}
+	if raw == nil {
+		return nil
+	}
+	return C.restoreNodeLabels(raw)
+}
 
-	})
+// Parse reads a config document of the given type (yaml, json, ...)
+// without touching the global C.
+func Parse(data []byte, typ string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigType(typ)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	c := new(Config)
+	if err := v.Unmarshal(c); err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(typ) {
+	case "yaml", "yml", "json":
+		if err := c.restoreNodeLabels(data); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// rawNodeLabels holds the node labels of a YAML or JSON document with
+// their keys as written.
+type rawNodeLabels struct {
+	Nodes []struct {
+		NodeLabels map[string]string `yaml:"nodeLabels"`
+	} `yaml:"nodes"`
+	NodeGroups []struct {
+		NodeLabels map[string]string `yaml:"nodeLabels"`
+		Overrides  []struct {
+			NodeLabels map[string]string `yaml:"nodeLabels"`
+		} `yaml:"overrides"`
+	} `yaml:"nodeGroups"`
+}
+
+// restoreNodeLabels replaces the node labels viper lowercased by the ones of
+// the document, Kubernetes label keys are case sensitive.
+func (c *Config) restoreNodeLabels(data []byte) error {
+	var raw rawNodeLabels
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for i, n := range raw.Nodes {
+		if i < len(c.Nodes) && c.Nodes[i] != nil && n.NodeLabels != nil {
+			c.Nodes[i].NodeLabels = n.NodeLabels
+		}
+	}
+	for i, g := range raw.NodeGroups {
+		if i >= len(c.NodeGroups) || c.NodeGroups[i] == nil {
+			continue
+		}
+		if g.NodeLabels != nil {
+			c.NodeGroups[i].NodeLabels = g.NodeLabels
+		}
+		for j, o := range g.Overrides {
+			if j < len(c.NodeGroups[i].Overrides) && c.NodeGroups[i].Overrides[j] != nil && o.NodeLabels != nil {
+				c.NodeGroups[i].Overrides[j].NodeLabels = o.NodeLabels
+			}
+		}
+	}
+	return nil
 }
 
 func PrintWithJSON() {
@@ -48,6 +144,33 @@ type nfsConfig struct {
 	Path   string `mapstructure:"path" yaml:"path" json:"path"`
 }
 
+type cniConfig struct {
+	Plugin  string `mapstructure:"plugin" yaml:"plugin" json:"plugin"`
+	PodCIDR string `mapstructure:"podCIDR" yaml:"podCIDR" json:"podCIDR"`
+}
+
+type kubeadmConfig struct {
+	ImageRepository  string            `mapstructure:"imageRepository" yaml:"imageRepository" json:"imageRepository"`
+	ServiceCIDR      string            `mapstructure:"serviceCIDR" yaml:"serviceCIDR" json:"serviceCIDR"`
+	DNSDomain        string            `mapstructure:"dnsDomain" yaml:"dnsDomain" json:"dnsDomain"`
+	CertSANs         []string          `mapstructure:"certSANs" yaml:"certSANs" json:"certSANs"`
+	KubeletExtraArgs map[string]string `mapstructure:"kubeletExtraArgs" yaml:"kubeletExtraArgs" json:"kubeletExtraArgs"`
+}
+
+type kubeVipConfig struct {
+	Mode      string `mapstructure:"mode" yaml:"mode" json:"mode"`
+	Interface string `mapstructure:"interface" yaml:"interface" json:"interface"`
+	BGPAS     uint32 `mapstructure:"bgpAS" yaml:"bgpAS" json:"bgpAS"`
+	BGPPeers  string `mapstructure:"bgpPeers" yaml:"bgpPeers" json:"bgpPeers"`
+}
+
+type loadBalancerConfig struct {
+	Mode    string        `mapstructure:"mode" yaml:"mode" json:"mode"`
+	Address string        `mapstructure:"address" yaml:"address" json:"address"`
+	Port    uint16        `mapstructure:"port" yaml:"port" json:"port"`
+	KubeVip kubeVipConfig `mapstructure:"kubeVip" yaml:"kubeVip" json:"kubeVip"`
+}
+
 type nodeConfig struct {
 	Address  string   `mapstructure:"address" yaml:"address" json:"address"`
 	Hostname string   `mapstructure:"hostname" yaml:"hostname" json:"hostname"`
@@ -55,16 +178,28 @@ type nodeConfig struct {
 	Port     uint16   `mapstructure:"port" yaml:"port" json:"port"`
 	Username string   `mapstructure:"username" yaml:"username" json:"username"`
 	Password string   `mapstructure:"password" yaml:"password" json:"password"`
-	KeyPath  string   `mapstructure:"keyPath" yaml:"keyPath" json:"keyPath"`
+	KeyPath  string   `mapstructure:"keyPath" yaml:"keyPath,omitempty" json:"keyPath"`
+	// Labels are free-form and only used to select nodes, e.g. --nodes zone=a
+	Labels map[string]string `mapstructure:"labels" yaml:"labels,omitempty" json:"labels"`
+	// NodeLabels and Taints are applied to the Kubernetes node after it joined
+	NodeLabels            map[string]string `mapstructure:"nodeLabels" yaml:"nodeLabels,omitempty" json:"nodeLabels"`
+	Taints                []string          `mapstructure:"taints" yaml:"taints,omitempty" json:"taints"`
+	KeepControlPlaneTaint bool              `mapstructure:"keepControlPlaneTaint" yaml:"keepControlPlaneTaint,omitempty" json:"keepControlPlaneTaint"`
 }
 
 type Config struct {
-	Namespace string        `mapstructure:"namespace" yaml:"namespace" json:"namespace"`
-	Registry  string        `mapstructure:"registry" yaml:"registry" json:"registry"`
-	CRISocket string        `mapstructure:"cri-socket" yaml:"cri-socket" json:"cri-socket"`
-	Vip       string        `mapstructure:"vip" yaml:"vip" json:"vip"`
-	Region    string        `mapstructure:"region" yaml:"region" json:"region"`
-	NTP       ntpConfig     `mapstructure:"ntp" yaml:"ntp" json:"ntp"`
-	NFS       nfsConfig     `mapstructure:"nfs" yaml:"nfs" json:"nfs"`
-	Nodes     []*nodeConfig `mapstructure:"nodes" yaml:"nodes" json:"nodes"`
+	Namespace         string             `mapstructure:"namespace" yaml:"namespace" json:"namespace"`
+	KubernetesVersion string             `mapstructure:"kubernetesVersion" yaml:"kubernetesVersion" json:"kubernetesVersion"`
+	Registry          string             `mapstructure:"registry" yaml:"registry" json:"registry"`
+	Runtime           string             `mapstructure:"runtime" yaml:"runtime" json:"runtime"`
+	CRISocket         string             `mapstructure:"cri-socket" yaml:"cri-socket" json:"cri-socket"`
+	CNI               cniConfig          `mapstructure:"cni" yaml:"cni" json:"cni"`
+	Kubeadm           kubeadmConfig      `mapstructure:"kubeadm" yaml:"kubeadm" json:"kubeadm"`
+	Vip               string             `mapstructure:"vip" yaml:"vip" json:"vip"`
+	LoadBalancer      loadBalancerConfig `mapstructure:"loadBalancer" yaml:"loadBalancer" json:"loadBalancer"`
+	Region            string             `mapstructure:"region" yaml:"region" json:"region"`
+	NTP               ntpConfig          `mapstructure:"ntp" yaml:"ntp" json:"ntp"`
+	NFS               nfsConfig          `mapstructure:"nfs" yaml:"nfs" json:"nfs"`
+	Nodes             []*nodeConfig      `mapstructure:"nodes" yaml:"nodes" json:"nodes"`
+	NodeGroups        []*nodeGroupConfig `mapstructure:"nodeGroups" yaml:"nodeGroups" json:"nodeGroups"`
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -24,3 +25,52 @@ func TestMustLoadCRISocket(t *testing.T) {
 		t.Fatalf("CRISocket = %q, want %q", C.CRISocket, want)
 	}
 }
+
+func TestLoadUnknownKey(t *testing.T) {
+	once = sync.Once{}
+	C = new(Config)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("nodes:\n  - address: 10.0.0.1\n    keypath: id_rsa\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path); err == nil || !strings.Contains(err.Error(), "did you mean keyPath?") {
+		t.Fatalf("Load() error = %v", err)
+	}
+}
+
+func TestParseKeepsNodeLabelCase(t *testing.T) {
+	c, err := Parse([]byte(`
+nodes:
+  - address: 10.0.0.1
+    labels:
+      Zone: a
+    nodeLabels:
+      example.com/GPU-Model: A100
+nodeGroups:
+  - addresses: 10.0.0.10-10.0.0.11
+    hostname: w-{{index}}
+    nodeLabels:
+      Tier: Web
+    overrides:
+      - address: 10.0.0.11
+        nodeLabels:
+          Tier: Cache
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Nodes[0].NodeLabels; got["example.com/GPU-Model"] != "A100" || len(got) != 1 {
+		t.Fatalf("node labels = %v", got)
+	}
+	if got := c.Nodes[0].Labels; got["zone"] != "a" {
+		t.Fatalf("selector labels = %v", got)
+	}
+	nodes, err := c.ExpandNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodes[1].NodeLabels["Tier"] != "Web" || nodes[2].NodeLabels["Tier"] != "Cache" {
+		t.Fatalf("group labels = %v, %v", nodes[1].NodeLabels, nodes[2].NodeLabels)
+	}
+}
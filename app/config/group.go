@@ -0,0 +1,194 @@
+package config
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxGroupSize guards against a typo in a range expanding into thousands of
+// nodes.
+const maxGroupSize = 1024
+
+// nodeGroupConfig describes many nodes that share roles and credentials.
+// Addresses is a range like 10.0.0.11-10.0.0.70 or a CIDR like
+// 10.0.0.0/26, of which the first Count hosts are taken when Count is set.
+// Hostname may contain {{index}}, numbered from IndexStart (default 1).
+// Overrides replace the non-empty fields of the node with the same address.
+type nodeGroupConfig struct {
+	nodeConfig `mapstructure:",squash" yaml:",inline" json:",inline"`
+	Addresses  string        `mapstructure:"addresses" yaml:"addresses" json:"addresses"`
+	Count      int           `mapstructure:"count" yaml:"count" json:"count"`
+	IndexStart *int          `mapstructure:"indexStart" yaml:"indexStart" json:"indexStart"`
+	Overrides  []*nodeConfig `mapstructure:"overrides" yaml:"overrides" json:"overrides"`
+}
+
+// ExpandNodes returns the nodes followed by the expanded node groups and
+// reports addresses or hostnames used more than once.
+func (c *Config) ExpandNodes() ([]*nodeConfig, error) {
+	nodes := append([]*nodeConfig(nil), c.Nodes...)
+	for i, g := range c.NodeGroups {
+		expanded, err := g.expand()
+		if err != nil {
+			return nil, fmt.Errorf("nodeGroups[%d]: %w", i, err)
+		}
+		nodes = append(nodes, expanded...)
+	}
+	if err := checkDuplicates(nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// checkDuplicates reports addresses or hostnames used by more than one node.
+func checkDuplicates(nodes []*nodeConfig) error {
+	addrs := map[string]bool{}
+	hostnames := map[string]bool{}
+	for _, n := range nodes {
+		if addrs[n.Address] {
+			return fmt.Errorf("duplicate node address %s", n.Address)
+		}
+		addrs[n.Address] = true
+		if n.Hostname == "" {
+			continue
+		}
+		if hostnames[n.Hostname] {
+			return fmt.Errorf("duplicate node hostname %s", n.Hostname)
+		}
+		hostnames[n.Hostname] = true
+	}
+	return nil
+}
+
+func (g *nodeGroupConfig) expand() ([]*nodeConfig, error) {
+	addrs, err := expandAddresses(g.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	if g.Count > 0 {
+		if g.Count > len(addrs) {
+			return nil, fmt.Errorf("count %d exceeds the %d addresses of %s", g.Count, len(addrs), g.Addresses)
+		}
+		addrs = addrs[:g.Count]
+	}
+	if len(addrs) > maxGroupSize {
+		return nil, fmt.Errorf("%s has %d addresses, more than %d", g.Addresses, len(addrs), maxGroupSize)
+	}
+	if len(addrs) > 1 && g.Hostname != "" && !strings.Contains(g.Hostname, "{{index}}") {
+		return nil, fmt.Errorf("hostname %q must contain {{index}}", g.Hostname)
+	}
+
+	start := 1
+	if g.IndexStart != nil {
+		start = *g.IndexStart
+	}
+	overrides := map[string]*nodeConfig{}
+	for _, o := range g.Overrides {
+		overrides[o.Address] = o
+	}
+
+	nodes := make([]*nodeConfig, 0, len(addrs))
+	for i, addr := range addrs {
+		n := g.nodeConfig
+		n.Address = addr
+		n.Hostname = strings.ReplaceAll(g.Hostname, "{{index}}", strconv.Itoa(start+i))
+		if o, ok := overrides[addr]; ok {
+			n.override(o)
+			delete(overrides, addr)
+		}
+		nodes = append(nodes, &n)
+	}
+	for addr := range overrides {
+		return nil, fmt.Errorf("override %s is not in %s", addr, g.Addresses)
+	}
+	return nodes, nil
+}
+
+// override replaces the fields of n that are set in o.
+func (n *nodeConfig) override(o *nodeConfig) {
+	if o.Hostname != "" {
+		n.Hostname = o.Hostname
+	}
+	if len(o.Role) > 0 {
+		n.Role = o.Role
+	}
+	if o.Port != 0 {
+		n.Port = o.Port
+	}
+	if o.Username != "" {
+		n.Username = o.Username
+	}
+	if o.Password != "" {
+		n.Password = o.Password
+	}
+	if o.KeyPath != "" {
+		n.KeyPath = o.KeyPath
+	}
+	if o.Labels != nil {
+		n.Labels = o.Labels
+	}
+	if o.NodeLabels != nil {
+		n.NodeLabels = o.NodeLabels
+	}
+	if o.Taints != nil {
+		n.Taints = o.Taints
+	}
+	if o.KeepControlPlaneTaint {
+		n.KeepControlPlaneTaint = true
+	}
+}
+
+// expandAddresses lists the IPv4 addresses of a range first-last or of the
+// hosts of a CIDR, without its network and broadcast address.
+func expandAddresses(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	var first, last uint32
+	switch {
+	case strings.Contains(s, "/"):
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		ip := network.IP.To4()
+		if ip == nil {
+			return nil, fmt.Errorf("%s: only IPv4 is supported", s)
+		}
+		ones, bits := network.Mask.Size()
+		first = binary.BigEndian.Uint32(ip)
+		last = first | (1<<(bits-ones) - 1)
+		if bits-ones > 1 {
+			first++
+			last--
+		}
+	case strings.Contains(s, "-"):
+		from, to, _ := strings.Cut(s, "-")
+		a, b := net.ParseIP(strings.TrimSpace(from)).To4(), net.ParseIP(strings.TrimSpace(to)).To4()
+		if a == nil || b == nil {
+			return nil, fmt.Errorf("invalid address range %s", s)
+		}
+		first, last = binary.BigEndian.Uint32(a), binary.BigEndian.Uint32(b)
+		if first > last {
+			return nil, fmt.Errorf("invalid address range %s: start is after end", s)
+		}
+	default:
+		ip := net.ParseIP(s).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid addresses %q: want a range or CIDR", s)
+		}
+		first = binary.BigEndian.Uint32(ip)
+		last = first
+	}
+	if last-first >= 1<<16 {
+		return nil, fmt.Errorf("%s has more than %d addresses", s, 1<<16)
+	}
+
+	addrs := make([]string, 0, last-first+1)
+	for v := uint64(first); v <= uint64(last); v++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, uint32(v))
+		addrs = append(addrs, ip.String())
+	}
+	return addrs, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandNodes(t *testing.T) {
+	c, err := Parse([]byte(`
+nodes:
+  - address: 10.0.0.1
+    hostname: master1
+    role: [etcd, controlplane]
+nodeGroups:
+  - addresses: 10.0.0.11-10.0.0.13
+    hostname: worker-{{index}}
+    role: [worker]
+    username: cm9vdA==
+    overrides:
+      - address: 10.0.0.12
+        hostname: gpu-1
+        taints: [gpu=true:NoSchedule]
+  - addresses: 10.0.1.0/30
+    hostname: infra-{{index}}
+    indexStart: 0
+    role: [worker]
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := c.ExpandNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range nodes {
+		got = append(got, n.Address+" "+n.Hostname)
+	}
+	want := []string{
+		"10.0.0.1 master1",
+		"10.0.0.11 worker-1",
+		"10.0.0.12 gpu-1",
+		"10.0.0.13 worker-3",
+		"10.0.1.1 infra-0",
+		"10.0.1.2 infra-1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("nodes = %q, want %q", got, want)
+	}
+	if nodes[2].Username != "cm9vdA==" || !reflect.DeepEqual(nodes[2].Taints, []string{"gpu=true:NoSchedule"}) {
+		t.Fatalf("override = %+v", nodes[2])
+	}
+	if nodes[1].Taints != nil {
+		t.Fatalf("override leaked into %s", nodes[1].Hostname)
+	}
+}
+
+func TestExpandNodesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{name: "duplicate address", config: "nodes:\n  - address: 10.0.0.11\nnodeGroups:\n  - addresses: 10.0.0.10-10.0.0.12\n    hostname: w-{{index}}\n"},
+		{name: "duplicate hostname", config: "nodes:\n  - address: 10.0.0.1\n    hostname: w-2\nnodeGroups:\n  - addresses: 10.0.0.10-10.0.0.12\n    hostname: w-{{index}}\n"},
+		{name: "no index", config: "nodeGroups:\n  - addresses: 10.0.0.10-10.0.0.12\n    hostname: worker\n"},
+		{name: "reversed range", config: "nodeGroups:\n  - addresses: 10.0.0.12-10.0.0.10\n"},
+		{name: "count", config: "nodeGroups:\n  - addresses: 10.0.0.0/30\n    count: 3\n"},
+		{name: "stray override", config: "nodeGroups:\n  - addresses: 10.0.0.0/30\n    overrides:\n      - address: 10.0.0.9\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Parse([]byte(tt.config), "yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.ExpandNodes(); err == nil {
+				t.Fatal("ExpandNodes() error = nil")
+			}
+		})
+	}
+}
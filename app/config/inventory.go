@@ -0,0 +1,534 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultInventoryGroups maps the roles to the Ansible groups kubespray and
+// most playbooks use.
+var DefaultInventoryGroups = map[string][]string{
+	"etcd":         {"etcd"},
+	"controlplane": {"kube_control_plane", "kube-master", "masters", "controlplane"},
+	"worker":       {"kube_node", "kube-node", "nodes", "workers", "worker"},
+}
+
+// root, base64 encoded like the config expects
+var defaultUsername = base64.StdEncoding.EncodeToString([]byte("root"))
+
+// lookupIP resolves host names without ansible_host, replaced in tests
+var lookupIP = net.LookupIP
+
+// inventory is an Ansible inventory: groups of hosts with variables.
+type inventory struct {
+	hosts  []string // in order of appearance
+	groups map[string]*inventoryGroup
+}
+
+type inventoryGroup struct {
+	hosts    map[string]map[string]string
+	children []string
+	vars     map[string]string
+}
+
+func newInventory() *inventory {
+	return &inventory{groups: map[string]*inventoryGroup{}}
+}
+
+func (inv *inventory) group(name string) *inventoryGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &inventoryGroup{hosts: map[string]map[string]string{}, vars: map[string]string{}}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+func (inv *inventory) addHost(group, host string, vars map[string]string) {
+	g := inv.group(group)
+	if g.hosts[host] == nil {
+		g.hosts[host] = map[string]string{}
+	}
+	for k, v := range vars {
+		g.hosts[host][k] = v
+	}
+	if !slices.Contains(inv.hosts, host) {
+		inv.hosts = append(inv.hosts, host)
+	}
+}
+
+// ImportInventory reads the inventory at path into config nodes. format is
+// ini or yaml for Ansible inventories, or csv; empty picks it from the file
+// extension. roles maps each role to the Ansible groups granting it, nil uses
+// DefaultInventoryGroups. Hosts without a role are left out. Host names
+// without ansible_host are resolved to their address, and addresses or
+// hostnames used twice are reported like in the config.
+func ImportInventory(path, format string, roles map[string][]string) ([]*nodeConfig, error) {
+	nodes, err := importInventory(path, format, roles)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		if err := n.resolveAddress(); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkDuplicates(nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+func importInventory(path, format string, roles map[string][]string) ([]*nodeConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".yml", ".yaml", ".json":
+			format = "yaml"
+		default:
+			format = "ini"
+		}
+	}
+
+	var inv *inventory
+	switch format {
+	case "csv":
+		return parseCSVInventory(data)
+	case "yaml":
+		inv, err = parseYAMLInventory(data)
+	case "ini":
+		inv, err = parseINIInventory(data)
+	default:
+		return nil, fmt.Errorf("unknown inventory format %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return inv.nodes(roles)
+}
+
+// node[01:20] and node[a:c] host patterns
+var hostRangePattern = regexp.MustCompile(`\[([0-9]+|[a-z]):([0-9]+|[a-z])\]`)
+
+func expandHostPattern(host string) ([]string, error) {
+	m := hostRangePattern.FindStringSubmatchIndex(host)
+	if m == nil {
+		return []string{host}, nil
+	}
+	from, to := host[m[2]:m[3]], host[m[4]:m[5]]
+	prefix, suffix := host[:m[0]], host[m[1]:]
+	var items []string
+	if a, err := strconv.Atoi(from); err == nil {
+		b, err := strconv.Atoi(to)
+		if err != nil || b < a {
+			return nil, fmt.Errorf("invalid host range %s", host)
+		}
+		width := 0
+		if len(from) > 1 && from[0] == '0' {
+			width = len(from)
+		}
+		for i := a; i <= b; i++ {
+			items = append(items, fmt.Sprintf("%0*d", width, i))
+		}
+	} else {
+		if len(to) != 1 || to[0] < from[0] {
+			return nil, fmt.Errorf("invalid host range %s", host)
+		}
+		for c := from[0]; c <= to[0]; c++ {
+			items = append(items, string(c))
+		}
+	}
+	var hosts []string
+	for _, item := range items {
+		expanded, err := expandHostPattern(prefix + item + suffix)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, expanded...)
+	}
+	return hosts, nil
+}
+
+// splitINIVars splits key=value pairs, honoring quotes.
+func splitINIVars(s string) (map[string]string, error) {
+	vars := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid variable %q", s)
+		}
+		var value string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in %q", s)
+			}
+			value, s = rest[1:end+1], rest[end+2:]
+		} else {
+			value, s, _ = strings.Cut(rest, " ")
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+	return vars, nil
+}
+
+func parseINIInventory(data []byte) (*inventory, error) {
+	inv := newInventory()
+	group, section := "ungrouped", ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(strings.ReplaceAll(scanner.Text(), "\t", " "))
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			group, section, _ = strings.Cut(line[1:len(line)-1], ":")
+			inv.group(group)
+			continue
+		}
+		switch section {
+		case "children":
+			g := inv.group(group)
+			g.children = append(g.children, line)
+			inv.group(line)
+		case "vars":
+			vars, err := splitINIVars(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			for k, v := range vars {
+				inv.group(group).vars[k] = v
+			}
+		case "":
+			pattern, rest, _ := strings.Cut(line, " ")
+			vars, err := splitINIVars(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			hosts, err := expandHostPattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			for _, h := range hosts {
+				inv.addHost(group, h, vars)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown section [%s:%s]", lineNo, group, section)
+		}
+	}
+	return inv, scanner.Err()
+}
+
+type yamlInventoryGroup struct {
+	Hosts    yaml.Node                      `yaml:"hosts"`
+	Vars     map[string]any                 `yaml:"vars"`
+	Children map[string]*yamlInventoryGroup `yaml:"children"`
+}
+
+func parseYAMLInventory(data []byte) (*inventory, error) {
+	var root map[string]*yamlInventoryGroup
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	inv := newInventory()
+	names := make([]string, 0, len(root))
+	for name := range root {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := inv.addYAMLGroup(name, root[name]); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+func (inv *inventory) addYAMLGroup(name string, yg *yamlInventoryGroup) error {
+	g := inv.group(name)
+	if yg == nil {
+		return nil
+	}
+	for k, v := range yg.Vars {
+		g.vars[k] = fmt.Sprint(v)
+	}
+	// hosts is a mapping of host patterns to their variables, in file order
+	if yg.Hosts.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(yg.Hosts.Content); i += 2 {
+			var vars map[string]any
+			if err := yg.Hosts.Content[i+1].Decode(&vars); err != nil {
+				return fmt.Errorf("host %s: %w", yg.Hosts.Content[i].Value, err)
+			}
+			hostVars := map[string]string{}
+			for k, v := range vars {
+				hostVars[k] = fmt.Sprint(v)
+			}
+			hosts, err := expandHostPattern(yg.Hosts.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			for _, h := range hosts {
+				inv.addHost(name, h, hostVars)
+			}
+		}
+	}
+	children := make([]string, 0, len(yg.Children))
+	for child := range yg.Children {
+		children = append(children, child)
+	}
+	sort.Strings(children)
+	for _, child := range children {
+		g.children = append(g.children, child)
+		if err := inv.addYAMLGroup(child, yg.Children[child]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberships returns the groups host belongs to, ancestors first, with
+// "all" at the front.
+func (inv *inventory) memberships(host string) []string {
+	parents := map[string][]string{}
+	for name, g := range inv.groups {
+		for _, child := range g.children {
+			parents[child] = append(parents[child], name)
+		}
+	}
+	depth := map[string]int{}
+	var visit func(name string, d int)
+	visit = func(name string, d int) {
+		if old, ok := depth[name]; ok && old >= d {
+			return
+		}
+		depth[name] = d
+		for _, p := range parents[name] {
+			visit(p, d-1)
+		}
+	}
+	for name, g := range inv.groups {
+		if _, ok := g.hosts[host]; ok {
+			visit(name, 0)
+		}
+	}
+	groups := make([]string, 0, len(depth))
+	for name := range depth {
+		if name != "all" {
+			groups = append(groups, name)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if depth[groups[i]] != depth[groups[j]] {
+			return depth[groups[i]] < depth[groups[j]]
+		}
+		return groups[i] < groups[j]
+	})
+	return append([]string{"all"}, groups...)
+}
+
+func (inv *inventory) nodes(roles map[string][]string) ([]*nodeConfig, error) {
+	if roles == nil {
+		roles = DefaultInventoryGroups
+	}
+	var nodes []*nodeConfig
+	for _, host := range inv.hosts {
+		groups := inv.memberships(host)
+		vars := map[string]string{}
+		for _, name := range groups {
+			if g, ok := inv.groups[name]; ok {
+				for k, v := range g.vars {
+					vars[k] = v
+				}
+			}
+		}
+		for _, name := range groups {
+			if g, ok := inv.groups[name]; ok {
+				for k, v := range g.hosts[host] {
+					vars[k] = v
+				}
+			}
+		}
+
+		n := &nodeConfig{Address: host, Port: 22, Username: defaultUsername}
+		if net.ParseIP(host) == nil {
+			n.Hostname = host
+		}
+		for _, role := range []string{"etcd", "controlplane", "worker"} {
+			if slices.ContainsFunc(roles[role], func(g string) bool { return slices.Contains(groups, g) }) {
+				n.Role = append(n.Role, role)
+			}
+		}
+		if len(n.Role) == 0 {
+			continue
+		}
+		if err := n.applyAnsibleVars(vars); err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no host of the inventory is in a group mapped to a role")
+	}
+	return nodes, nil
+}
+
+// resolveAddress replaces a host name in Address by its IP address, which
+// Kubernetes and etcd need. IPv4 addresses are preferred.
+func (n *nodeConfig) resolveAddress() error {
+	if net.ParseIP(n.Address) != nil {
+		return nil
+	}
+	ips, err := lookupIP(n.Address)
+	if err == nil && len(ips) == 0 {
+		err = errors.New("no addresses")
+	}
+	if err != nil {
+		return fmt.Errorf("%s is not an IP address, set ansible_host or the address column: %w", n.Address, err)
+	}
+	ip := ips[0]
+	for _, candidate := range ips {
+		if candidate.To4() != nil {
+			ip = candidate
+			break
+		}
+	}
+	n.Address = ip.String()
+	return nil
+}
+
+func (n *nodeConfig) applyAnsibleVars(vars map[string]string) error {
+	if v := vars["ansible_host"]; v != "" {
+		n.Address = v
+	}
+	if v := vars["ansible_port"]; v != "" {
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid ansible_port %q", v)
+		}
+		n.Port = uint16(port)
+	}
+	if v := vars["ansible_user"]; v != "" {
+		n.Username = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	for _, key := range []string{"ansible_password", "ansible_ssh_pass"} {
+		if v := vars[key]; v != "" {
+			n.Password = base64.StdEncoding.EncodeToString([]byte(v))
+			break
+		}
+	}
+	if v := vars["ansible_ssh_private_key_file"]; v != "" {
+		n.KeyPath = expandHome(v)
+	}
+	return nil
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// parseCSVInventory reads nodes from CSV with a header row naming the
+// columns address, hostname, role, port, username, password and keyPath.
+// Roles are separated by spaces, semicolons or commas; username and password
+// are plain text.
+func parseCSVInventory(data []byte) ([]*nodeConfig, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "roles":
+			name = "role"
+		case "keypath", "key", "key_path":
+			name = "keypath"
+		case "user":
+			name = "username"
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["address"]; !ok {
+		return nil, errors.New("csv header has no address column")
+	}
+	if _, ok := columns["role"]; !ok {
+		return nil, errors.New("csv header has no role column")
+	}
+
+	var nodes []*nodeConfig
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		n := &nodeConfig{
+			Address:  field("address"),
+			Port:     22,
+			Username: defaultUsername,
+			Hostname: field("hostname"),
+			Role: strings.FieldsFunc(field("role"), func(r rune) bool {
+				return r == ' ' || r == ';' || r == ',' || r == '|'
+			}),
+			KeyPath: expandHome(field("keypath")),
+		}
+		if n.Address == "" {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("line %d: address is empty", line)
+		}
+		if v := field("port"); v != "" {
+			port, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid port %q", n.Address, v)
+			}
+			n.Port = uint16(port)
+		}
+		if v := field("username"); v != "" {
+			n.Username = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+		if v := field("password"); v != "" {
+			n.Password = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("csv has no nodes")
+	}
+	return nodes, nil
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// resolve stubs the name resolution of hosts without ansible_host.
+func resolve(t *testing.T, hosts map[string]string) {
+	t.Helper()
+	orig := lookupIP
+	t.Cleanup(func() { lookupIP = orig })
+	lookupIP = func(host string) ([]net.IP, error) {
+		if addr, ok := hosts[host]; ok {
+			return []net.IP{net.ParseIP("fd00::1"), net.ParseIP(addr)}, nil
+		}
+		return nil, fmt.Errorf("lookup %s: no such host", host)
+	}
+}
+
+func writeInventory(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func summarize(nodes []*nodeConfig) []string {
+	var s []string
+	for _, n := range nodes {
+		user, _ := base64.StdEncoding.DecodeString(n.Username)
+		s = append(s, strings.Join([]string{n.Hostname, n.Address, string(user), n.KeyPath, strings.Join(n.Role, ",")}, "|"))
+	}
+	return s
+}
+
+func TestImportInventoryINI(t *testing.T) {
+	path := writeInventory(t, "hosts", `
+[all:vars]
+ansible_user=deploy
+ansible_ssh_private_key_file=/keys/id_rsa
+
+[kube_control_plane]
+master[1:2]
+
+[etcd:children]
+kube_control_plane
+
+[kube_node]
+node[01:02]
+10.0.0.30 ansible_user="ops user" ansible_port=2222
+
+[kube_node:vars]
+ansible_user=worker
+
+[bastion]
+jump ansible_host=10.0.0.99
+`)
+	resolve(t, map[string]string{"master1": "10.0.0.1", "master2": "10.0.0.2", "node01": "10.0.0.21", "node02": "10.0.0.22"})
+	nodes, err := ImportInventory(path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"master1|10.0.0.1|deploy|/keys/id_rsa|etcd,controlplane",
+		"master2|10.0.0.2|deploy|/keys/id_rsa|etcd,controlplane",
+		"node01|10.0.0.21|worker|/keys/id_rsa|worker",
+		"node02|10.0.0.22|worker|/keys/id_rsa|worker",
+		"|10.0.0.30|ops user|/keys/id_rsa|worker",
+	}
+	if got := summarize(nodes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("nodes = %q, want %q", got, want)
+	}
+	if nodes[4].Port != 2222 || nodes[0].Port != 22 {
+		t.Fatalf("ports = %d, %d", nodes[4].Port, nodes[0].Port)
+	}
+}
+
+func TestImportInventoryYAML(t *testing.T) {
+	path := writeInventory(t, "inventory.yml", `
+all:
+  vars:
+    ansible_user: deploy
+  children:
+    masters:
+      hosts:
+        m1:
+          ansible_host: 10.0.0.1
+      vars:
+        ansible_user: admin
+    etcd:
+      children:
+        masters:
+    workers:
+      hosts:
+        w1:
+          ansible_host: 10.0.0.11
+          ansible_port: 2200
+`)
+	nodes, err := ImportInventory(path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"m1|10.0.0.1|admin||etcd,controlplane",
+		"w1|10.0.0.11|deploy||worker",
+	}
+	if got := summarize(nodes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("nodes = %q, want %q", got, want)
+	}
+	if nodes[1].Port != 2200 {
+		t.Fatalf("port = %d", nodes[1].Port)
+	}
+}
+
+func TestImportInventoryCSV(t *testing.T) {
+	path := writeInventory(t, "nodes.csv", `address,hostname,roles,user,password
+# comment
+10.0.0.1,master1,"etcd,controlplane",admin,secret
+10.0.0.11,worker1,worker,,
+`)
+	nodes, err := ImportInventory(path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"master1|10.0.0.1|admin||etcd,controlplane",
+		"worker1|10.0.0.11|root||worker",
+	}
+	if got := summarize(nodes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("nodes = %q, want %q", got, want)
+	}
+	if pw, _ := base64.StdEncoding.DecodeString(nodes[0].Password); string(pw) != "secret" {
+		t.Fatalf("password = %q", pw)
+	}
+}
+
+func TestImportInventoryErrors(t *testing.T) {
+	resolve(t, map[string]string{"node01": "10.0.0.21"})
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{name: "shared ansible_host", file: "hosts", content: "[kube_node]\nnode[1:2] ansible_host=10.0.0.1\n", want: "duplicate node address 10.0.0.1"},
+		{name: "resolves to a listed address", file: "hosts", content: "[kube_node]\nnode01\n10.0.0.21\n", want: "duplicate node address 10.0.0.21"},
+		{name: "unresolvable", file: "hosts", content: "[kube_node]\nnode02\n", want: "node02 is not an IP address"},
+		{name: "csv duplicate hostname", file: "nodes.csv", content: "address,hostname,role\n10.0.0.1,w1,worker\n10.0.0.2,w1,worker\n", want: "duplicate node hostname w1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ImportInventory(writeInventory(t, tt.file, tt.content), "", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ImportInventory() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The patterns of addresses only tell editors which characters to expect,
+// Validate checks the format of the value as well.
+const (
+	ipPattern     = `^[0-9A-Fa-f.:]+$`
+	cidrPattern   = `^[0-9A-Fa-f.:]+/[0-9]{1,3}$`
+	hostPattern   = `^[0-9A-Za-z.:-]+$`
+	base64Pattern = `^[A-Za-z0-9+/]*={0,2}$`
+)
+
+// formats are the values of the format keyword Validate understands: an
+// IPv4 or IPv6 address, a network, or an address or DNS name.
+var formats = map[string]func(string) bool{
+	"ip": func(s string) bool {
+		return net.ParseIP(s) != nil
+	},
+	"cidr": func(s string) bool {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	},
+	"host": func(s string) bool {
+		return net.ParseIP(s) != nil || hostnamePattern.MatchString(s)
+	},
+}
+
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*$`)
+
+// fieldSchema annotates a field of the config, keyed by "<type>.<json name>".
+type fieldSchema struct {
+	description string
+	enum        []string
+	pattern     string
+	format      string
+}
+
+var fieldSchemas = map[string]fieldSchema{
+	"Config.namespace":         {description: "namespace of the applications in resource/app"},
+	"Config.kubernetesVersion": {description: "installs from resource/kubeadm/<version>, falls back to resource/kubeadm when empty"},
+	"Config.registry":          {description: "image registry, also the default kubeadm image repository prefix"},
+	"Config.runtime":           {description: "container runtime, docker by default", enum: []string{"docker", "containerd", "cri-o"}},
+	"Config.cri-socket":        {description: "CRI socket, derived from runtime when empty"},
+	"Config.vip":               {description: "virtual IP of the control plane, required with several control planes", pattern: ipPattern, format: "ip"},
+	"Config.region":            {description: "passed to keepalived"},
+	"Config.nodes":             {description: "cluster nodes, the first control plane initializes the cluster"},
+	"Config.nodeGroups":        {description: "nodes sharing roles and credentials, expanded after nodes"},
+
+	"cniConfig.plugin":  {description: "network plugin, calico by default", enum: []string{"calico", "flannel", "cilium", "none"}},
+	"cniConfig.podCIDR": {description: "pod network, defaults to the plugin default", pattern: cidrPattern, format: "cidr"},
+
+	"kubeadmConfig.imageRepository":  {description: "defaults to <registry>/google_containers"},
+	"kubeadmConfig.serviceCIDR":      {description: "service network, 10.96.0.0/12 by default", pattern: cidrPattern, format: "cidr"},
+	"kubeadmConfig.dnsDomain":        {description: "cluster DNS domain, cluster.local by default"},
+	"kubeadmConfig.certSANs":         {description: "extra API server certificate names, the vip and control planes are always included"},
+	"kubeadmConfig.kubeletExtraArgs": {description: "kubelet flags without the leading --"},
+
+	"loadBalancerConfig.mode":    {description: "how the control plane endpoint is served", enum: []string{"haproxy", "kube-vip", "external"}},
+	"loadBalancerConfig.address": {description: "control plane endpoint of an external load balancer"},
+	"loadBalancerConfig.port":    {description: "haproxy frontend port (default 8443) or external load balancer port"},
+	"kubeVipConfig.mode":         {description: "kube-vip announcement mode", enum: []string{"arp", "bgp"}},
+	"kubeVipConfig.interface":    {description: "interface the vip is announced on"},
+	"kubeVipConfig.bgpAS":        {description: "local AS number in bgp mode"},
+	"kubeVipConfig.bgpPeers":     {description: "address:AS::multihop peers, comma separated"},
+
+	"ntpConfig.server":   {description: "chrony server address or hostname, skipped when empty", pattern: hostPattern, format: "host"},
+	"ntpConfig.allow":    {description: "network allowed to sync from the server", pattern: cidrPattern, format: "cidr"},
+	"ntpConfig.timezone": {description: "timezone of the nodes, e.g. Asia/Shanghai"},
+
+	"nfsConfig.server": {description: "NFS server, storage is skipped when empty"},
+	"nfsConfig.path":   {description: "exported path"},
+
+	"nodeConfig.address":               {description: "IP address or host name of the node, used for SSH and by Kubernetes", pattern: hostPattern, format: "host"},
+	"nodeConfig.hostname":              {description: "hostname set on the node and its Kubernetes node name"},
+	"nodeConfig.role":                  {description: "roles of the node"},
+	"nodeConfig.port":                  {description: "SSH port"},
+	"nodeConfig.username":              {description: "SSH user, base64 encoded", pattern: base64Pattern},
+	"nodeConfig.password":              {description: "SSH password, base64 encoded", pattern: base64Pattern},
+	"nodeConfig.keyPath":               {description: "private key file, used instead of the password"},
+	"nodeConfig.labels":                {description: "free-form labels for --nodes selectors"},
+	"nodeConfig.nodeLabels":            {description: "labels put on the Kubernetes node after it joined"},
+	"nodeConfig.taints":                {description: "taints put on the Kubernetes node after it joined, key[=value]:effect"},
+	"nodeConfig.keepControlPlaneTaint": {description: "keep the control-plane taint on a dedicated control plane"},
+
+	"nodeGroupConfig.addresses":  {description: "address range first-last or CIDR", pattern: `^[0-9.]+(-[0-9.]+|/[0-9]+)?$`},
+	"nodeGroupConfig.count":      {description: "take only the first count addresses"},
+	"nodeGroupConfig.indexStart": {description: "first {{index}} of the hostname template, 1 by default"},
+	"nodeGroupConfig.overrides":  {description: "per address overrides of the group values"},
+}
+
+// items of these fields are annotated too
+var itemSchemas = map[string]fieldSchema{
+	"nodeConfig.role":   {enum: []string{"etcd", "controlplane", "worker"}},
+	"nodeConfig.taints": {pattern: `^[^=:]+(=[^:]*)?:(NoSchedule|PreferNoSchedule|NoExecute)$`},
+}
+
+// Schema is the JSON Schema of the config file.
+func Schema() map[string]any {
+	s := typeSchema(reflect.TypeOf(Config{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "k8s-tool config"
+	return s
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := map[string]any{"type": "integer", "minimum": 0}
+		if t.Bits() < 64 {
+			s["maximum"] = uint64(math.MaxUint64 >> (64 - t.Bits()))
+		}
+		return s
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		addProperties(t, props)
+		return map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	}
+	panic(fmt.Sprintf("no schema for %s", t))
+}
+
+func addProperties(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && name == "" {
+			addProperties(f.Type, props)
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		s := typeSchema(f.Type)
+		key := t.Name() + "." + name
+		annotate(s, fieldSchemas[key])
+		if items, ok := s["items"].(map[string]any); ok {
+			annotate(items, itemSchemas[key])
+		}
+		props[name] = s
+	}
+}
+
+func annotate(s map[string]any, fs fieldSchema) {
+	if fs.description != "" {
+		s["description"] = fs.description
+	}
+	if len(fs.enum) > 0 {
+		s["enum"] = fs.enum
+	}
+	if fs.pattern != "" {
+		s["pattern"] = fs.pattern
+	}
+	if fs.format != "" {
+		s["format"] = fs.format
+	}
+}
+
+// Validate checks a YAML or JSON config document against the schema and
+// reports every unknown key and invalid value with its line. Empty values
+// are left to the defaults and not checked.
+func Validate(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var problems []string
+	validateNode(Schema(), doc.Content[0], "", &problems)
+	if len(problems) > 0 {
+		return errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validateNode(s map[string]any, n *yaml.Node, path string, problems *[]string) {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Tag == "!!null" {
+		return
+	}
+	report := func(format string, a ...any) {
+		where := path
+		if where == "" {
+			where = "config"
+		}
+		*problems = append(*problems, fmt.Sprintf("line %d: %s: ", n.Line, where)+fmt.Sprintf(format, a...))
+	}
+
+	switch s["type"] {
+	case "object":
+		if n.Kind != yaml.MappingNode {
+			report("want a mapping")
+			return
+		}
+		props, _ := s["properties"].(map[string]any)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Value == "<<" {
+				validateNode(s, value, path, problems)
+				continue
+			}
+			child := key.Value
+			if path != "" {
+				child = path + "." + key.Value
+			}
+			if ps, ok := props[key.Value].(map[string]any); ok {
+				validateNode(ps, value, child, problems)
+				continue
+			}
+			if extra, ok := s["additionalProperties"].(map[string]any); ok {
+				validateNode(extra, value, child, problems)
+				continue
+			}
+			msg := fmt.Sprintf("line %d: %s: unknown key", key.Line, child)
+			if hint := similarKey(key.Value, props); hint != "" {
+				msg += fmt.Sprintf(", did you mean %s?", hint)
+			}
+			*problems = append(*problems, msg)
+		}
+	case "array":
+		if n.Kind != yaml.SequenceNode {
+			report("want a list")
+			return
+		}
+		items, _ := s["items"].(map[string]any)
+		for i, item := range n.Content {
+			validateNode(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	default:
+		if n.Kind != yaml.ScalarNode {
+			report("want a %s", s["type"])
+			return
+		}
+		validateScalar(s, n.Value, report)
+	}
+}
+
+func validateScalar(s map[string]any, value string, report func(string, ...any)) {
+	switch s["type"] {
+	case "integer":
+		v, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			report("%q is not an integer", value)
+			return
+		}
+		if min, ok := s["minimum"].(int); ok && v < int64(min) {
+			report("%d is below %d", v, min)
+		}
+		if max, ok := s["maximum"].(uint64); ok && v > 0 && uint64(v) > max {
+			report("%d is above %d", v, max)
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			report("%q is not true or false", value)
+		}
+	case "string":
+		if value == "" {
+			return
+		}
+		if enum, ok := s["enum"].([]string); ok && !slices.Contains(enum, value) {
+			report("%q is not one of %s", value, strings.Join(enum, ", "))
+		}
+		if pattern, ok := s["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(value) {
+			report("%q does not match %s", value, pattern)
+		} else if format, ok := s["format"].(string); ok && !formats[format](value) {
+			report("%q is not a valid %s", value, format)
+		}
+	}
+}
+
+// similarKey finds a property differing from key only in case or dashes.
+func similarKey(key string, props map[string]any) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s))
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if normalize(name) == normalize(key) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateReadmeExample(t *testing.T) {
+	readme, err := os.ReadFile("../../README.MD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rest, _ := strings.Cut(string(readme), "## config file")
+	_, example, _ := strings.Cut(rest, "```yaml\n")
+	example, _, _ = strings.Cut(example, "```")
+	if err := Validate([]byte(example)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{name: "unknown key", config: "nodes:\n  - address: 10.0.0.1\n    keypath: id_rsa\n", want: "line 3: nodes[0].keypath: unknown key, did you mean keyPath?"},
+		{name: "unknown top level key", config: "vips: 10.0.0.100\n", want: "line 1: vips: unknown key"},
+		{name: "role", config: "nodes:\n  - role: [master]\n", want: `nodes[0].role[0]: "master" is not one of etcd, controlplane, worker`},
+		{name: "vip", config: "vip: 10.0.0.300\n", want: `vip: "10.0.0.300" is not a valid ip`},
+		{name: "node address", config: "nodes:\n  - address: node_01\n", want: `nodes[0].address: "node_01" does not match`},
+		{name: "node host name", config: "nodes:\n  - address: -node01\n", want: `nodes[0].address: "-node01" is not a valid host`},
+		{name: "ntp server", config: "ntp:\n  server: ntp_1.example.com\n", want: `ntp.server: "ntp_1.example.com" does not match`},
+		{name: "cidr", config: "cni:\n  podCIDR: 10.244.0.0\n", want: `cni.podCIDR: "10.244.0.0" does not match`},
+		{name: "port", config: "nodes:\n  - port: 70000\n", want: "nodes[0].port: 70000 is above 65535"},
+		{name: "mapping", config: "ntp: 10.0.0.1\n", want: "ntp: want a mapping"},
+		{name: "group override", config: "nodeGroups:\n  - addresses: 10.0.0.0/30\n    overrides:\n      - adress: 10.0.0.1\n", want: "nodeGroups[0].overrides[0].adress: unknown key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAddresses(t *testing.T) {
+	config := `
+vip: fd00::100
+ntp:
+  server: ntp.aliyun.com
+  allow: fd00::/64
+kubeadm:
+  serviceCIDR: fd00:10:96::/112
+nodes:
+  - address: fd00::11
+  - address: node01.example.com
+`
+	if err := Validate([]byte(config)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,410 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// NodeProbe is what the wizard learns about a node over SSH.
+type NodeProbe struct {
+	Hostname string
+	OS       string
+	Arch     string
+}
+
+// Prober connects to a node with plain text credentials and describes it.
+type Prober func(address string, port uint16, username, password, keyPath string) (NodeProbe, error)
+
+// Wizard asks for the settings of a new cluster and renders them as a
+// commented config file.
+type Wizard struct {
+	In  *bufio.Reader
+	Out io.Writer
+	// ReadPassword reads a secret without echo, nil reads a line from In.
+	ReadPassword func() (string, error)
+	// Probe verifies the credentials of each node, nil skips probing.
+	Probe Prober
+
+	config Config
+	probes map[string]NodeProbe
+}
+
+func (w *Wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.Out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.Out, "%s: ", question)
+	}
+	line, err := w.In.ReadString('\n')
+	if err != nil && line == "" {
+		if err == io.EOF {
+			return "", errors.New("input ended before the config was complete")
+		}
+		return "", err
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// askValid repeats the question until valid accepts the answer.
+func (w *Wizard) askValid(question, def string, valid func(string) error) (string, error) {
+	for {
+		answer, err := w.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		if err := valid(answer); err != nil {
+			fmt.Fprintf(w.Out, "  %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+func (w *Wizard) confirm(question string, def bool) (bool, error) {
+	d := "y/N"
+	if def {
+		d = "Y/n"
+	}
+	answer, err := w.ask(question+" ("+d+")", "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+func (w *Wizard) password(question string) (string, error) {
+	if w.ReadPassword == nil {
+		return w.ask(question, "")
+	}
+	fmt.Fprintf(w.Out, "%s: ", question)
+	p, err := w.ReadPassword()
+	fmt.Fprintln(w.Out)
+	return p, err
+}
+
+func optional(valid func(string) error) func(string) error {
+	return func(s string) error {
+		if s == "" {
+			return nil
+		}
+		return valid(s)
+	}
+}
+
+func validIP(s string) error {
+	if net.ParseIP(s) == nil {
+		return fmt.Errorf("%q is not an IP address", s)
+	}
+	return nil
+}
+
+func validCIDR(s string) error {
+	if _, _, err := net.ParseCIDR(s); err != nil {
+		return fmt.Errorf("%q is not a CIDR like 192.168.0.0/16", s)
+	}
+	return nil
+}
+
+func validRoles(s string) error {
+	roles := splitRoles(s)
+	if len(roles) == 0 {
+		return errors.New("at least one role is required")
+	}
+	for _, r := range roles {
+		if !slices.Contains([]string{"etcd", "controlplane", "worker"}, r) {
+			return fmt.Errorf("invalid role %q, use etcd, controlplane and worker", r)
+		}
+	}
+	return nil
+}
+
+func splitRoles(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+// Run asks the questions and returns the rendered config file.
+func (w *Wizard) Run() ([]byte, error) {
+	w.config = Config{Namespace: "default"}
+	w.probes = map[string]NodeProbe{}
+
+	probe := false
+	if w.Probe != nil {
+		var err error
+		if probe, err = w.confirm("Verify each node over SSH", true); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprintln(w.Out, "Nodes, leave the address empty when done.")
+	for {
+		n, err := w.askNode(probe)
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			if err := checkRoles(w.config.Nodes); err != nil {
+				fmt.Fprintf(w.Out, "  %v\n", err)
+				continue
+			}
+			break
+		}
+		w.config.Nodes = append(w.config.Nodes, n)
+	}
+
+	var err error
+	controlPlanes := 0
+	for _, n := range w.config.Nodes {
+		if slices.Contains(n.Role, "controlplane") {
+			controlPlanes++
+		}
+	}
+	vipValid := optional(validIP)
+	if controlPlanes > 1 {
+		vipValid = validIP
+	}
+	if w.config.Vip, err = w.askValid("Virtual IP of the control plane (required with several control planes)", "", vipValid); err != nil {
+		return nil, err
+	}
+	if w.config.Registry, err = w.ask("Image registry", "registry.cn-hangzhou.aliyuncs.com"); err != nil {
+		return nil, err
+	}
+
+	if w.config.NTP.Server, err = w.askValid("NTP server address (empty to skip)", w.config.Nodes[0].Address, optional(validIP)); err != nil {
+		return nil, err
+	}
+	if w.config.NTP.Server != "" {
+		allow := w.config.NTP.Server + "/24"
+		if w.config.NTP.Allow, err = w.askValid("Network allowed to sync from it", allow, validCIDR); err != nil {
+			return nil, err
+		}
+		if w.config.NTP.Timezone, err = w.ask("Timezone", "Asia/Shanghai"); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.config.NFS.Server, err = w.askValid("NFS server address (empty to skip)", "", optional(validIP)); err != nil {
+		return nil, err
+	}
+	if w.config.NFS.Server != "" {
+		if w.config.NFS.Path, err = w.ask("NFS export path", "/data/nfs"); err != nil {
+			return nil, err
+		}
+	}
+	return w.render()
+}
+
+// askNode asks for one node, nil when the address is left empty.
+func (w *Wizard) askNode(probe bool) (*nodeConfig, error) {
+	first := len(w.config.Nodes) == 0
+	for {
+		valid := validIP
+		if !first {
+			valid = optional(validIP)
+		}
+		address, err := w.askValid(fmt.Sprintf("Node %d address", len(w.config.Nodes)+1), "", func(s string) error {
+			if err := valid(s); err != nil {
+				return err
+			}
+			for _, n := range w.config.Nodes {
+				if n.Address == s {
+					return fmt.Errorf("%s is already added", s)
+				}
+			}
+			return nil
+		})
+		if err != nil || address == "" {
+			return nil, err
+		}
+
+		portText, err := w.askValid("  SSH port", "22", func(s string) error {
+			if p, err := strconv.ParseUint(s, 10, 16); err != nil || p == 0 {
+				return fmt.Errorf("%q is not a port", s)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		port, _ := strconv.ParseUint(portText, 10, 16)
+		username, err := w.ask("  SSH user", "root")
+		if err != nil {
+			return nil, err
+		}
+		keyPath, err := w.ask("  Private key file (empty to use a password)", "")
+		if err != nil {
+			return nil, err
+		}
+		var password string
+		if keyPath == "" {
+			if password, err = w.password("  SSH password"); err != nil {
+				return nil, err
+			}
+		}
+
+		var found NodeProbe
+		if probe {
+			fmt.Fprintf(w.Out, "  connecting to %s...\n", address)
+			found, err = w.Probe(address, uint16(port), username, password, keyPath)
+			if err != nil {
+				fmt.Fprintf(w.Out, "  %v\n", err)
+				keep, err := w.confirm("  Keep this node anyway", false)
+				if err != nil {
+					return nil, err
+				}
+				if !keep {
+					continue
+				}
+			} else {
+				fmt.Fprintf(w.Out, "  %s, %s %s\n", found.Hostname, found.OS, found.Arch)
+				w.probes[address] = found
+			}
+		}
+
+		hostname, err := w.askValid("  Hostname", found.Hostname, func(s string) error {
+			if s == "" {
+				return errors.New("hostname is required")
+			}
+			for _, n := range w.config.Nodes {
+				if n.Hostname == s {
+					return fmt.Errorf("%s is already used", s)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		defRoles := "worker"
+		if first {
+			defRoles = "etcd,controlplane,worker"
+		}
+		roles, err := w.askValid("  Roles (etcd, controlplane, worker)", defRoles, validRoles)
+		if err != nil {
+			return nil, err
+		}
+
+		return &nodeConfig{
+			Address:  address,
+			Hostname: hostname,
+			Role:     splitRoles(roles),
+			Port:     uint16(port),
+			Username: base64.StdEncoding.EncodeToString([]byte(username)),
+			Password: base64.StdEncoding.EncodeToString([]byte(password)),
+			KeyPath:  keyPath,
+		}, nil
+	}
+}
+
+// checkRoles mirrors the role checks of the installer.
+func checkRoles(nodes []*nodeConfig) error {
+	var etcd, control, worker int
+	for _, n := range nodes {
+		for _, r := range n.Role {
+			switch r {
+			case "etcd":
+				etcd++
+			case "controlplane":
+				control++
+			case "worker":
+				worker++
+			}
+		}
+	}
+	switch {
+	case len(nodes) == 0:
+		return errors.New("add at least one node")
+	case len(nodes) == 1 && (etcd == 0 || control == 0 || worker == 0):
+		return errors.New("a single node needs all roles (etcd controlplane worker), add more nodes")
+	case etcd == 0 || control == 0 || worker == 0:
+		return errors.New("the cluster needs etcd, controlplane and worker nodes, add more nodes")
+	}
+	return nil
+}
+
+var configTemplate = template.Must(template.New("config").Funcs(template.FuncMap{
+	"q":    strconv.Quote,
+	"join": strings.Join,
+}).Parse(`# generated by k8s-tool config init, see the README for every option
+namespace: {{q .Namespace}}
+# kubernetesVersion: v1.28.2  # installs from resource/kubeadm/<version>, falls back to resource/kubeadm when empty
+registry: {{q .Registry}}
+# runtime: docker  # docker (default, with cri-dockerd), containerd or cri-o
+# cni:
+#   plugin: calico  # calico (default), flannel, cilium or none
+#   podCIDR: 10.244.0.0/16
+{{if .NTP.Server}}
+ntp:
+  server: {{q .NTP.Server}}
+  allow: {{q .NTP.Allow}}  # clients allowed to sync from the server
+  timezone: {{q .NTP.Timezone}}
+{{else}}
+# ntp:
+#   server: 192.168.1.101
+#   allow: 192.168.1.0/24
+#   timezone: Asia/Shanghai
+{{end}}
+{{if .Vip}}vip: {{q .Vip}}{{else}}# vip: 192.168.56.151  # required with several control planes{{end}}
+loadBalancer:
+  mode: haproxy  # haproxy (default, haproxy + keepalived), kube-vip (static pods) or external
+
+nodes:
+{{- range .Nodes}}
+  - address: {{q .Address}}
+    hostname: {{q .Hostname}}{{with index $.Notes .Address}}  # {{.}}{{end}}
+    role: [{{join .Role ", "}}]
+    port: {{.Port}}
+    username: {{q .Username}}  # base64
+    {{if .KeyPath}}keyPath: {{q .KeyPath}}{{else}}password: {{q .Password}}  # base64{{end}}
+{{- end}}
+{{if .NFS.Server}}
+nfs:
+  server: {{q .NFS.Server}}
+  path: {{q .NFS.Path}}
+{{else}}
+# nfs:
+#   server: 192.168.57.101
+#   path: /data/nfs
+{{end -}}
+`))
+
+func (w *Wizard) render() ([]byte, error) {
+	notes := map[string]string{}
+	for addr, p := range w.probes {
+		notes[addr] = strings.TrimSpace(p.OS + " " + p.Arch)
+	}
+	var b bytes.Buffer
+	err := configTemplate.Execute(&b, struct {
+		*Config
+		Notes map[string]string
+	}{&w.config, notes})
+	if err != nil {
+		return nil, err
+	}
+	// the result must load like any other config
+	if err := Validate(b.Bytes()); err != nil {
+		return nil, fmt.Errorf("generated config is invalid: %w", err)
+	}
+	if _, err := Parse(b.Bytes(), "yaml"); err != nil {
+		return nil, fmt.Errorf("generated config is invalid: %w", err)
+	}
+	return b.Bytes(), nil
+}
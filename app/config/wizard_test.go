@@ -0,0 +1,78 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWizard(t *testing.T) {
+	input := strings.Join([]string{
+		"",             // verify over ssh: yes
+		"10.0.0.1",     // node 1
+		"",             // port 22
+		"deploy",       // user
+		"",             // password auth
+		"secret",       // password
+		"",             // hostname from probe
+		"",             // all roles
+		"10.0.0.2",     // node 2
+		"2222",         // port
+		"",             // root
+		"/keys/id_rsa", // key
+		"n",            // probe failed, do not keep
+		"10.0.0.3",     // node 2 again
+		"",             // port
+		"",             // root
+		"/keys/id_rsa", // key
+		"worker-1",     // hostname
+		"worker",       // roles
+		"",             // done
+		"10.0.0.100",   // vip
+		"",             // registry
+		"",             // ntp server is the first node
+		"10.0.0.0/24",  // allow
+		"UTC",          // timezone
+		"",             // no nfs
+	}, "\n") + "\n"
+	w := &Wizard{
+		In:  bufio.NewReader(strings.NewReader(input)),
+		Out: io.Discard,
+		Probe: func(address string, port uint16, username, password, keyPath string) (NodeProbe, error) {
+			if address == "10.0.0.2" {
+				return NodeProbe{}, errors.New("connection refused")
+			}
+			if address == "10.0.0.1" && (username != "deploy" || password != "secret") {
+				t.Errorf("probe credentials = %s/%s", username, password)
+			}
+			return NodeProbe{Hostname: "node-" + address, OS: "rocky 9.3 (rhel)", Arch: "x86_64"}, nil
+		},
+	}
+	data, err := w.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Parse(data, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Nodes) != 2 {
+		t.Fatalf("nodes = %d, want 2\n%s", len(c.Nodes), data)
+	}
+	first, second := c.Nodes[0], c.Nodes[1]
+	if first.Hostname != "node-10.0.0.1" || first.Username != "ZGVwbG95" || first.Password != "c2VjcmV0" ||
+		strings.Join(first.Role, ",") != "etcd,controlplane,worker" {
+		t.Errorf("first node = %+v", first)
+	}
+	if second.Address != "10.0.0.3" || second.KeyPath != "/keys/id_rsa" || second.Password != "" || second.Port != 22 {
+		t.Errorf("second node = %+v", second)
+	}
+	if c.Vip != "10.0.0.100" || c.NTP.Server != "10.0.0.1" || c.NTP.Timezone != "UTC" || c.NFS.Server != "" {
+		t.Errorf("config = %+v\n%s", c, data)
+	}
+	if !strings.Contains(string(data), "# rocky 9.3 (rhel) x86_64") {
+		t.Errorf("probe note missing:\n%s", data)
+	}
+}
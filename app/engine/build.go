@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"io"
+	"k8s-tool/app/config"
+	"k8s-tool/app/node"
+)
+
+// FromConfig creates an Engine for c and adds every configured node to it.
+// output, when not nil, supplies the stdout/stderr writers of each node.
+func FromConfig(c *config.Config, output func(addr string) (io.Writer, io.Writer), opts ...Option) (*Engine, error) {
+	opts = append([]Option{
+		Namespace(c.Namespace),
+		CRISocket(c.CRISocket),
+		Runtime(c.Runtime),
+		CNI(c.CNI.Plugin, c.CNI.PodCIDR),
+		KubernetesVersion(c.KubernetesVersion),
+		Kubeadm(c.Kubeadm.ImageRepository, c.Kubeadm.ServiceCIDR, c.Kubeadm.DNSDomain, c.Kubeadm.CertSANs, c.Kubeadm.KubeletExtraArgs),
+		LoadBalancer(c.LoadBalancer.Mode, c.LoadBalancer.Address, c.LoadBalancer.Port),
+		KubeVip(c.LoadBalancer.KubeVip.Mode, c.LoadBalancer.KubeVip.Interface, c.LoadBalancer.KubeVip.BGPAS, c.LoadBalancer.KubeVip.BGPPeers),
+		Registry(c.Registry),
+		Vip(c.Vip),
+		Region(c.Region),
+		NTP(c.NTP.Server, c.NTP.Allow, c.NTP.Timezone),
+		NFS(c.NFS.Server, c.NFS.Path),
+	}, opts...)
+	e, err := New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := c.ExpandNodes()
+	if err != nil {
+		return nil, err
+	}
+	for _, nn := range nodes {
+		nodeOpts := []node.Option{
+			node.Address(nn.Address),
+			node.Role(nn.Role),
+			node.Port(nn.Port),
+			node.Username(nn.Username),
+			node.Password(nn.Password),
+			node.KeyPath(nn.KeyPath),
+			node.Labels(nn.Labels),
+			node.NodeLabels(nn.NodeLabels),
+			node.Taints(nn.Taints),
+			node.KeepControlPlaneTaint(nn.KeepControlPlaneTaint),
+			node.Logger(e.log),
+		}
+		if output != nil {
+			nodeOpts = append(nodeOpts, node.Output(output(nn.Address)))
+		}
+		n, err := node.New(nodeOpts...)
+		if err != nil {
+			return nil, err
+		}
+		n.SetHostname(nn.Hostname)
+		if err := e.AddNode(n); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"fmt"
+	"k8s-tool/app/node"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// CertExpiration is a certificate reported by kubeadm certs check-expiration.
+type CertExpiration struct {
+	Node      string
+	Name      string
+	Expires   time.Time
+	Residual  string
+	Authority bool
+}
+
+// admin.conf   Jan 01, 2025 12:00 UTC   364d   ca   no
+var certLinePattern = regexp.MustCompile(`^(\S+)\s+([A-Z][a-z]{2} \d{2}, \d{4} \d{2}:\d{2} \S+)\s+(\S+)`)
+
+func parseCertExpiration(hostname, output string) ([]CertExpiration, error) {
+	var certs []CertExpiration
+	authority := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "CERTIFICATE AUTHORITY") {
+			authority = true
+			continue
+		}
+		m := certLinePattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		expires, err := time.Parse("Jan 02, 2006 15:04 MST", m[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s: parse expiration of %s: %w", hostname, m[1], err)
+		}
+		certs = append(certs, CertExpiration{
+			Node:      hostname,
+			Name:      m[1],
+			Expires:   expires,
+			Residual:  m[3],
+			Authority: authority,
+		})
+	}
+	return certs, nil
+}
+
+// connectControlPlanes connects only the control plane nodes.
+func (e *Engine) connectControlPlanes() error {
+	var eg errgroup.Group
+	for _, n := range e.etcdMembers() {
+		eg.Go(func() error {
+			return n.Connect()
+		})
+	}
+	return eg.Wait()
+}
+
+// CheckCerts runs kubeadm certs check-expiration on every control plane and
+// returns the certificates sorted by expiration.
+func (e *Engine) CheckCerts() ([]CertExpiration, error) {
+	if err := e.check(); err != nil {
+		return nil, err
+	}
+	if err := e.connectControlPlanes(); err != nil {
+		return nil, err
+	}
+	defer e.closeAll()
+
+	var (
+		mu    sync.Mutex
+		certs []CertExpiration
+		eg    errgroup.Group
+	)
+	for _, n := range e.etcdMembers() {
+		eg.Go(func() error {
+			out, err := n.Run("", "sudo kubeadm certs check-expiration")
+			if err != nil {
+				return fmt.Errorf("%s: %w", n.GetHostname(), err)
+			}
+			c, err := parseCertExpiration(n.GetHostname(), string(out))
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			certs = append(certs, c...)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(certs, func(i, j int) bool {
+		if !certs[i].Expires.Equal(certs[j].Expires) {
+			return certs[i].Expires.Before(certs[j].Expires)
+		}
+		if certs[i].Node != certs[j].Node {
+			return certs[i].Node < certs[j].Node
+		}
+		return certs[i].Name < certs[j].Name
+	})
+	return certs, nil
+}
+
+// controlPlanePods are the static pods that read the renewed certificates.
+var controlPlanePods = []string{"etcd", "kube-apiserver", "kube-controller-manager", "kube-scheduler"}
+
+// RenewCerts renews the kubeadm certificates on every control plane, one
+// node at a time, restarting its static pods and refreshing the admin
+// kubeconfig before moving on.
+func (e *Engine) RenewCerts() error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if err := e.connectControlPlanes(); err != nil {
+		return err
+	}
+	defer e.closeAll()
+
+	for _, n := range e.etcdMembers() {
+		if err := e.renewCerts(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) renewCerts(n node.Node) error {
+	e.log.Infof("Renewing certificates on %s", n.GetHostname())
+	out, err := n.Run("", "sudo kubeadm certs renew all")
+	e.log.Info(string(out))
+	if err != nil {
+		return fmt.Errorf("%s: renew certificates: %w", n.GetHostname(), err)
+	}
+	if err := stopStaticPods(n, controlPlanePods...); err != nil {
+		return err
+	}
+	if err := startStaticPods(n); err != nil {
+		return err
+	}
+	if err := e.configureKubectl(n); err != nil {
+		return err
+	}
+	out, err = n.Run("", apiServerReadyCheck.cmd)
+	if len(out) > 0 {
+		e.log.Info(string(out))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: API server is not ready after renewing certificates: %w", n.GetHostname(), err)
+	}
+	return nil
+}
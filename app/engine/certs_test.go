@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+const checkExpirationOutput = `[check-expiration] Reading configuration from the cluster...
+[check-expiration] FYI: You can look at this config file with 'kubectl -n kube-system get cm kubeadm-config -o yaml'
+
+CERTIFICATE                EXPIRES                  RESIDUAL TIME   CERTIFICATE AUTHORITY   EXTERNALLY MANAGED
+admin.conf                 Jan 02, 2025 08:30 UTC   364d            ca                      no
+apiserver                  Jan 01, 2020 12:00 UTC   <invalid>       ca                      no
+
+CERTIFICATE AUTHORITY   EXPIRES                  RESIDUAL TIME   EXTERNALLY MANAGED
+ca                      Dec 30, 2033 08:30 UTC   9y              no
+`
+
+func TestParseCertExpiration(t *testing.T) {
+	certs, err := parseCertExpiration("master1", checkExpirationOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CertExpiration{
+		{Node: "master1", Name: "admin.conf", Expires: time.Date(2025, 1, 2, 8, 30, 0, 0, time.UTC), Residual: "364d"},
+		{Node: "master1", Name: "apiserver", Expires: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), Residual: "<invalid>"},
+		{Node: "master1", Name: "ca", Expires: time.Date(2033, 12, 30, 8, 30, 0, 0, time.UTC), Residual: "9y", Authority: true},
+	}
+	if len(certs) != len(want) {
+		t.Fatalf("certs = %+v, want %+v", certs, want)
+	}
+	for i := range want {
+		got := certs[i]
+		if got.Node != want[i].Node || got.Name != want[i].Name || !got.Expires.Equal(want[i].Expires) ||
+			got.Residual != want[i].Residual || got.Authority != want[i].Authority {
+			t.Fatalf("certs[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestParseCertExpirationEmpty(t *testing.T) {
+	certs, err := parseCertExpiration("master1", "[check-expiration] Error reading configuration\n")
+	if err != nil || len(certs) != 0 {
+		t.Fatalf("parseCertExpiration() = %v, %v", certs, err)
+	}
+}
@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultCNI = "calico"
+
+type readinessCheck struct {
+	name string
+	cmd  string
+}
+
+var nodesReadyCheck = readinessCheck{
+	name: "all nodes Ready",
+	cmd:  "kubectl wait --for=condition=Ready nodes --all --timeout=5m",
+}
+
+var apiServerReadyCheck = readinessCheck{
+	name: "API server",
+	cmd:  "for i in $(seq 60); do kubectl get --raw=/readyz >/dev/null 2>&1 && exit 0; sleep 5; done; exit 1",
+}
+
+type cniPlugin struct {
+	name string
+	// manifest is applied from resource/<name>; empty means nothing is installed
+	manifest string
+	// manifestCIDR is the pod CIDR the manifest ships with
+	manifestCIDR string
+	// cidrEnv is the container env var holding the pod CIDR, which the
+	// manifest may ship commented out
+	cidrEnv string
+	// defaultCIDR is the pod CIDR used when none is configured, it must not
+	// overlap the default service CIDR
+	defaultCIDR string
+	checks      []readinessCheck
+}
+
+var cniPlugins = map[string]cniPlugin{
+	"calico": {
+		name:         "calico",
+		manifest:     "calico.yaml",
+		manifestCIDR: "192.168.0.0/16",
+		cidrEnv:      "CALICO_IPV4POOL_CIDR",
+		defaultCIDR:  "192.168.0.0/16",
+		checks: []readinessCheck{{
+			name: "calico-node daemonset",
+			cmd:  "kubectl -n kube-system rollout status daemonset/calico-node --timeout=5m",
+		}},
+	},
+	"flannel": {
+		name:         "flannel",
+		manifest:     "flannel.yaml",
+		manifestCIDR: "10.244.0.0/16",
+		defaultCIDR:  "10.244.0.0/16",
+		checks: []readinessCheck{{
+			name: "kube-flannel daemonset",
+			cmd:  "kubectl -n kube-flannel rollout status daemonset/kube-flannel-ds --timeout=5m",
+		}},
+	},
+	"cilium": {
+		name:         "cilium",
+		manifest:     "cilium.yaml",
+		manifestCIDR: "10.0.0.0/8",
+		// the manifest's 10.0.0.0/8 contains the service CIDR 10.96.0.0/12
+		defaultCIDR: "10.0.0.0/16",
+		checks: []readinessCheck{
+			{
+				name: "cilium daemonset",
+				cmd:  "kubectl -n kube-system rollout status daemonset/cilium --timeout=5m",
+			},
+			{
+				name: "cilium-operator deployment",
+				cmd:  "kubectl -n kube-system rollout status deployment/cilium-operator --timeout=5m",
+			},
+		},
+	},
+	"none": {name: "none"},
+}
+
+func lookupCNI(name string) (cniPlugin, error) {
+	if name == "" {
+		name = defaultCNI
+	}
+	p, ok := cniPlugins[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(cniPlugins))
+		for n := range cniPlugins {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return cniPlugin{}, fmt.Errorf("invalid cni %q: valid plugins are %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+func validateCIDR(cidr string) error {
+	if cidr == "" {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(cidr); err != nil {
+		return fmt.Errorf("invalid pod cidr: %w", err)
+	}
+	return nil
+}
+
+// podCIDR is the pod subnet handed to kubeadm and the CNI manifest.
+func (e *Engine) podCIDR() string {
+	if e.cni.podCIDR != "" {
+		return e.cni.podCIDR
+	}
+	return e.cni.plugin.defaultCIDR
+}
+
+func (e *Engine) installNetwork() error {
+	p := e.cni.plugin
+	if p.manifest == "" {
+		e.log.Warn("cni is none, install a network plugin before nodes become Ready")
+		return nil
+	}
+
+	var eg errgroup.Group
+	for i := range e.nodes {
+		n := e.nodes[i]
+		if !n.IsNew() {
+			continue
+		}
+		eg.Go(func() error {
+			return n.Install(p.name)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	// 渲染后的清单另存，保留资源包中的原始清单
+	manifest := p.manifest
+	if cidr := e.podCIDR(); cidr != p.manifestCIDR || p.cidrEnv != "" {
+		data, err := e.master.ReadFile(filepath.Join(p.name, p.manifest))
+		if err != nil {
+			return err
+		}
+		rendered, err := p.render(string(data), cidr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.manifest, err)
+		}
+		manifest = "rendered-" + p.manifest
+		if err := e.master.WriteFile(filepath.Join(p.name, manifest), []byte(rendered), 0o644); err != nil {
+			return err
+		}
+	}
+	if _, err := e.master.Run(filepath.Join("resource", p.name), fmt.Sprintf("kubectl apply -f %s", manifest)); err != nil {
+		return err
+	}
+	if err := e.waitForClusterNetworkReady(); err != nil {
+		return err
+	}
+	e.installed(p.name)
+	return nil
+}
+
+// render sets the pod CIDR of the manifest to cidr: the cidrEnv env var is
+// uncommented and set, other manifests have manifestCIDR replaced.
+func (p cniPlugin) render(manifest, cidr string) (string, error) {
+	if p.cidrEnv == "" {
+		return strings.ReplaceAll(manifest, p.manifestCIDR, cidr), nil
+	}
+	lines := strings.Split(manifest, "\n")
+	found := false
+	for i := 0; i < len(lines); i++ {
+		line := uncommentYAML(lines[i])
+		if strings.TrimSpace(line) != "- name: "+p.cidrEnv {
+			continue
+		}
+		found = true
+		lines[i] = line
+		value := line[:len(line)-len(strings.TrimLeft(line, " "))] + fmt.Sprintf("  value: %q", cidr)
+		if i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(uncommentYAML(lines[i+1])), "value:") {
+			lines[i+1] = value
+		} else {
+			lines = slices.Insert(lines, i+1, value)
+		}
+		i++
+	}
+	if !found {
+		return "", fmt.Errorf("env %s not found", p.cidrEnv)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// uncommentYAML drops the comment marker in front of a commented-out line,
+// keeping its indentation: "  # - name: x" becomes "  - name: x".
+func uncommentYAML(line string) string {
+	rest := strings.TrimLeft(line, " ")
+	if !strings.HasPrefix(rest, "#") {
+		return line
+	}
+	return line[:len(line)-len(rest)] + strings.TrimPrefix(rest[1:], " ")
+}
@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// calicoEnv is the calico-node env of calico.yaml as shipped, with the pod
+// CIDR commented out.
+const calicoEnv = `            - name: IP
+              value: "autodetect"
+            # The default IPv4 pool to create on startup if none exists. Pod IPs will be
+            # chosen from this range. Changing this value after installation will have
+            # no effect. This should fall within ` + "`--cluster-cidr`" + `, e.g. 192.168.0.0/16.
+            # - name: CALICO_IPV4POOL_CIDR
+            #   value: "192.168.0.0/16"
+            # Disable file logging so ` + "`kubectl logs`" + ` works.
+            - name: CALICO_DISABLE_FILE_LOGGING
+              value: "true"`
+
+func TestRenderCNIManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   string
+		manifest string
+		cidr     string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "calico commented out",
+			plugin:   "calico",
+			manifest: calicoEnv,
+			cidr:     "10.244.0.0/16",
+			want: strings.Replace(calicoEnv,
+				"            # - name: CALICO_IPV4POOL_CIDR\n            #   value: \"192.168.0.0/16\"",
+				"            - name: CALICO_IPV4POOL_CIDR\n              value: \"10.244.0.0/16\"", 1),
+		},
+		{
+			name:     "calico default cidr",
+			plugin:   "calico",
+			manifest: calicoEnv,
+			cidr:     "192.168.0.0/16",
+			want: strings.Replace(calicoEnv,
+				"            # - name: CALICO_IPV4POOL_CIDR\n            #   value: \"192.168.0.0/16\"",
+				"            - name: CALICO_IPV4POOL_CIDR\n              value: \"192.168.0.0/16\"", 1),
+		},
+		{
+			name:     "calico already set",
+			plugin:   "calico",
+			manifest: "  env:\n    - name: CALICO_IPV4POOL_CIDR\n      value: \"172.16.0.0/16\"\n    - name: FELIX_LOGSEVERITYSCREEN\n      value: \"info\"",
+			cidr:     "10.244.0.0/16",
+			want:     "  env:\n    - name: CALICO_IPV4POOL_CIDR\n      value: \"10.244.0.0/16\"\n    - name: FELIX_LOGSEVERITYSCREEN\n      value: \"info\"",
+		},
+		{
+			name:     "calico without value",
+			plugin:   "calico",
+			manifest: "  env:\n    # - name: CALICO_IPV4POOL_CIDR\n    - name: FELIX_LOGSEVERITYSCREEN\n      value: \"info\"",
+			cidr:     "10.244.0.0/16",
+			want:     "  env:\n    - name: CALICO_IPV4POOL_CIDR\n      value: \"10.244.0.0/16\"\n    - name: FELIX_LOGSEVERITYSCREEN\n      value: \"info\"",
+		},
+		{
+			name:     "calico without env",
+			plugin:   "calico",
+			manifest: "  env:\n    - name: FELIX_LOGSEVERITYSCREEN\n      value: \"info\"",
+			cidr:     "10.244.0.0/16",
+			wantErr:  "env CALICO_IPV4POOL_CIDR not found",
+		},
+		{
+			name:     "flannel",
+			plugin:   "flannel",
+			manifest: "  net-conf.json: |\n    {\n      \"Network\": \"10.244.0.0/16\",\n      \"Backend\": {\"Type\": \"vxlan\"}\n    }",
+			cidr:     "172.20.0.0/16",
+			want:     "  net-conf.json: |\n    {\n      \"Network\": \"172.20.0.0/16\",\n      \"Backend\": {\"Type\": \"vxlan\"}\n    }",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cniPlugins[tt.plugin].render(tt.manifest, tt.cidr)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("render() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("render() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallNetworkManifest(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "calico",
+			want: []string{
+				"node1: install calico",
+				"node1: read calico/calico.yaml",
+				"node1: write calico/rendered-calico.yaml",
+				"node1: kubectl apply -f rendered-calico.yaml",
+			},
+		},
+		{
+			name: "flannel default cidr",
+			opts: []Option{CNI("flannel", "")},
+			want: []string{
+				"node1: install flannel",
+				"node1: kubectl apply -f flannel.yaml",
+			},
+		},
+		{
+			name: "flannel cidr",
+			opts: []Option{CNI("flannel", "172.20.0.0/16")},
+			want: []string{
+				"node1: install flannel",
+				"node1: read flannel/flannel.yaml",
+				"node1: write flannel/rendered-flannel.yaml",
+				"node1: kubectl apply -f rendered-flannel.yaml",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := func(hostname, cmd string) (string, error) {
+				if strings.HasPrefix(cmd, "read ") {
+					return calicoEnv, nil
+				}
+				return "", nil
+			}
+			e, log := newFakeEngine(t, tt.opts, reply, "10.0.0.1:etcd,controlplane,worker")
+			if err := e.installNetwork(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range log.entries {
+				if !strings.Contains(entry, "rollout status") && !strings.Contains(entry, "kubectl wait") {
+					got = append(got, entry)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("installNetwork() ran\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
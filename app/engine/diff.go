@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"fmt"
+	"k8s-tool/app/node"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DiffItem is a difference between the config and the live cluster.
+type DiffItem struct {
+	Subject     string
+	Problem     string
+	Remediation string
+}
+
+const controlPlaneTaint = "node-role.kubernetes.io/control-plane"
+
+// Diff compares the config with the cluster: the node list, hostnames and
+// addresses, roles, haproxy backends and /etc/hosts on every node.
+func (e *Engine) Diff() ([]DiffItem, error) {
+	if err := e.check(); err != nil {
+		return nil, err
+	}
+	defer e.closeAll()
+	if err := e.connectMaster(); err != nil {
+		return nil, err
+	}
+	reachable, unreachable := e.connectReachable()
+
+	var items []DiffItem
+	for addr, err := range unreachable {
+		items = append(items, DiffItem{
+			Subject:     addr,
+			Problem:     fmt.Sprintf("cannot connect: %v", err),
+			Remediation: "check the address, port and credentials in the config",
+		})
+	}
+
+	live, err := e.liveNodes()
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, e.diffNodes(live)...)
+
+	var mu sync.Mutex
+	var eg errgroup.Group
+	for _, n := range reachable {
+		eg.Go(func() error {
+			var found []DiffItem
+			if e.lb.mode == lbHaproxy && n.IsETCD() {
+				d, err := e.diffHaproxy(n)
+				if err != nil {
+					return err
+				}
+				found = append(found, d...)
+			}
+			d, err := e.diffHosts(n)
+			if err != nil {
+				return err
+			}
+			found = append(found, d...)
+			mu.Lock()
+			items = append(items, found...)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Subject < items[j].Subject })
+	return items, nil
+}
+
+func (e *Engine) diffNodes(live []liveNode) []DiffItem {
+	var items []DiffItem
+	byName := map[string]liveNode{}
+	byIP := map[string]liveNode{}
+	for _, l := range live {
+		byName[l.Name] = l
+		byIP[l.InternalIP] = l
+	}
+
+	known := map[string]bool{}
+	for _, n := range e.nodes {
+		subject := fmt.Sprintf("%s (%s)", n.GetHostname(), n.GetAddress())
+		l, ok := byName[n.GetHostname()]
+		if !ok {
+			if other, found := byIP[n.GetAddress()]; found {
+				known[other.Name] = true
+				items = append(items, DiffItem{
+					Subject:     subject,
+					Problem:     fmt.Sprintf("registered as %q", other.Name),
+					Remediation: fmt.Sprintf("set hostname %s in the config, or reset the node and join it again with --update", other.Name),
+				})
+				continue
+			}
+			items = append(items, DiffItem{
+				Subject:     subject,
+				Problem:     "in the config but not in the cluster",
+				Remediation: "join it with install --update, or remove it from the config",
+			})
+			continue
+		}
+		known[l.Name] = true
+		if l.InternalIP != n.GetAddress() {
+			items = append(items, DiffItem{
+				Subject:     subject,
+				Problem:     fmt.Sprintf("cluster reports internal IP %s", l.InternalIP),
+				Remediation: fmt.Sprintf("set address %s in the config, or fix the kubelet --node-ip on the node", l.InternalIP),
+			})
+		}
+
+		isControl := slices.Contains(l.Roles, "control-plane") || slices.Contains(l.Roles, "master")
+		switch {
+		case n.IsControl() && !isControl:
+			items = append(items, DiffItem{
+				Subject:     subject,
+				Problem:     "controlplane role in the config, the node is not a control plane",
+				Remediation: "remove the controlplane role from the config, or reset the node and join it again as a control plane",
+			})
+		case !n.IsControl() && isControl:
+			items = append(items, DiffItem{
+				Subject:     subject,
+				Problem:     "control plane in the cluster without the controlplane role in the config",
+				Remediation: "add the controlplane role to the config",
+			})
+		}
+		if isControl {
+			tainted := l.hasTaint(controlPlaneTaint) || l.hasTaint("node-role.kubernetes.io/master")
+			switch {
+			case !n.KeepControlPlaneTaint() && tainted:
+				items = append(items, DiffItem{
+					Subject:     subject,
+					Problem:     "control plane taint is set, the config removes it",
+					Remediation: fmt.Sprintf("kubectl taint node %s %s-, or set keepControlPlaneTaint in the config", l.Name, controlPlaneTaint),
+				})
+			case n.KeepControlPlaneTaint() && !tainted:
+				items = append(items, DiffItem{
+					Subject:     subject,
+					Problem:     "control plane taint is missing, the config keeps it",
+					Remediation: fmt.Sprintf("kubectl taint node %s %s:NoSchedule", l.Name, controlPlaneTaint),
+				})
+			}
+		}
+		for k, v := range n.GetNodeLabels() {
+			if got, ok := l.Labels[k]; !ok || got != v {
+				items = append(items, DiffItem{
+					Subject:     subject,
+					Problem:     fmt.Sprintf("label %s=%s is missing", k, v),
+					Remediation: fmt.Sprintf("kubectl label node %s --overwrite %s=%s", l.Name, k, v),
+				})
+			}
+		}
+		for _, t := range n.GetTaints() {
+			kv, effect, _ := strings.Cut(t, ":")
+			key, _, _ := strings.Cut(kv, "=")
+			if !slices.Contains(l.Taints, key+":"+effect) {
+				items = append(items, DiffItem{
+					Subject:     subject,
+					Problem:     fmt.Sprintf("taint %s is missing", t),
+					Remediation: fmt.Sprintf("kubectl taint node %s --overwrite %s", l.Name, t),
+				})
+			}
+		}
+	}
+
+	for _, l := range live {
+		if known[l.Name] {
+			continue
+		}
+		items = append(items, DiffItem{
+			Subject:     fmt.Sprintf("%s (%s)", l.Name, l.InternalIP),
+			Problem:     "in the cluster but not in the config",
+			Remediation: fmt.Sprintf("add it to the config, or kubectl drain %s and kubectl delete node %s", l.Name, l.Name),
+		})
+	}
+	return items
+}
+
+// diffHaproxy compares the backends in haproxy.cfg on n with the control
+// planes.
+func (e *Engine) diffHaproxy(n node.Node) ([]DiffItem, error) {
+	out, err := n.Run("", "cat /etc/haproxy/haproxy.cfg 2>/dev/null || true")
+	if err != nil {
+		return nil, err
+	}
+	subject := fmt.Sprintf("%s haproxy", n.GetHostname())
+	if strings.TrimSpace(string(out)) == "" {
+		return []DiffItem{{
+			Subject:     subject,
+			Problem:     "/etc/haproxy/haproxy.cfg is missing",
+			Remediation: "run install --step 8 to install the load balancer",
+		}}, nil
+	}
+	backends := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "server" {
+			host, _, err := net.SplitHostPort(fields[2])
+			if err != nil {
+				host = fields[2]
+			}
+			backends[host] = true
+		}
+	}
+
+	var items []DiffItem
+	controls := map[string]bool{}
+	for _, cp := range e.nodes {
+		if !cp.IsControl() {
+			continue
+		}
+		controls[cp.GetAddress()] = true
+		if !backends[cp.GetAddress()] {
+			items = append(items, DiffItem{
+				Subject:     subject,
+				Problem:     fmt.Sprintf("control plane %s (%s) is not a backend", cp.GetHostname(), cp.GetAddress()),
+				Remediation: "run install --step 8 to regenerate the haproxy config",
+			})
+		}
+	}
+	for addr := range backends {
+		if !controls[addr] {
+			items = append(items, DiffItem{
+				Subject:     subject,
+				Problem:     fmt.Sprintf("backend %s is not a control plane in the config", addr),
+				Remediation: "run install --step 8 to regenerate the haproxy config",
+			})
+		}
+	}
+	return items, nil
+}
+
+// diffHosts checks that /etc/hosts on n maps every config hostname to its
+// address.
+func (e *Engine) diffHosts(n node.Node) ([]DiffItem, error) {
+	out, err := n.Run("", "cat /etc/hosts")
+	if err != nil {
+		return nil, err
+	}
+	hosts := map[string][]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, name := range fields[1:] {
+			hosts[name] = append(hosts[name], fields[0])
+		}
+	}
+
+	var items []DiffItem
+	subject := fmt.Sprintf("%s /etc/hosts", n.GetHostname())
+	for _, other := range e.nodes {
+		name := other.GetHostname()
+		if name == "" {
+			continue
+		}
+		addrs := hosts[name]
+		switch {
+		case len(addrs) == 0:
+			items = append(items, DiffItem{
+				Subject:     subject,
+				Problem:     fmt.Sprintf("no entry for %s", name),
+				Remediation: fmt.Sprintf("add \"%s %s\" to /etc/hosts", other.GetAddress(), name),
+			})
+		case !slices.Contains(addrs, other.GetAddress()):
+			items = append(items, DiffItem{
+				Subject:     subject,
+				Problem:     fmt.Sprintf("%s resolves to %s, config has %s", name, strings.Join(addrs, ", "), other.GetAddress()),
+				Remediation: fmt.Sprintf("replace the %s entry with \"%s %s\"", name, other.GetAddress(), name),
+			})
+		}
+	}
+	return items, nil
+}
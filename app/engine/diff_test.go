@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"k8s-tool/app/node"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// problems flattens items to "subject: problem", sorted.
+func problems(items []DiffItem) []string {
+	var got []string
+	for _, item := range items {
+		got = append(got, item.Subject+": "+item.Problem)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestDiffNodes(t *testing.T) {
+	controlPlane := "node-role.kubernetes.io/control-plane="
+	cpTaint := "node-role.kubernetes.io/control-plane:NoSchedule"
+	tests := []struct {
+		name string
+		keep bool
+		live []string
+		want []string
+	}{
+		{
+			name: "in sync",
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", []string{controlPlane}, nil),
+				kubectlNode("node2", "10.0.0.2", true, "v1.28.2", []string{"disk=ssd"}, []string{"dedicated:NoSchedule"}),
+			},
+		},
+		{
+			name: "control plane taint kept",
+			keep: true,
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", []string{controlPlane}, []string{cpTaint}),
+				kubectlNode("node2", "10.0.0.2", true, "v1.28.2", []string{"disk=ssd"}, []string{"dedicated:NoSchedule"}),
+			},
+		},
+		{
+			name: "registered under another name",
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", []string{controlPlane}, nil),
+				kubectlNode("worker-2", "10.0.0.2", true, "v1.28.2", []string{"disk=ssd"}, []string{"dedicated:NoSchedule"}),
+			},
+			want: []string{`node2 (10.0.0.2): registered as "worker-2"`},
+		},
+		{
+			name: "missing and extra",
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", []string{controlPlane}, nil),
+				kubectlNode("node9", "10.0.0.9", true, "v1.28.2", nil, nil),
+			},
+			want: []string{
+				"node2 (10.0.0.2): in the config but not in the cluster",
+				"node9 (10.0.0.9): in the cluster but not in the config",
+			},
+		},
+		{
+			name: "internal ip",
+			live: []string{
+				kubectlNode("node1", "10.0.0.11", true, "v1.28.2", []string{controlPlane}, nil),
+				kubectlNode("node2", "10.0.0.2", true, "v1.28.2", []string{"disk=ssd"}, []string{"dedicated:NoSchedule"}),
+			},
+			want: []string{"node1 (10.0.0.1): cluster reports internal IP 10.0.0.11"},
+		},
+		{
+			name: "roles",
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", nil, nil),
+				kubectlNode("node2", "10.0.0.2", true, "v1.28.2", []string{controlPlane, "disk=ssd"}, []string{"dedicated:NoSchedule"}),
+			},
+			want: []string{
+				"node1 (10.0.0.1): controlplane role in the config, the node is not a control plane",
+				"node2 (10.0.0.2): control plane in the cluster without the controlplane role in the config",
+			},
+		},
+		{
+			name: "control plane taint set",
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", []string{controlPlane}, []string{cpTaint}),
+				kubectlNode("node2", "10.0.0.2", true, "v1.28.2", []string{"disk=ssd"}, []string{"dedicated:NoSchedule"}),
+			},
+			want: []string{"node1 (10.0.0.1): control plane taint is set, the config removes it"},
+		},
+		{
+			name: "control plane taint missing",
+			keep: true,
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", []string{controlPlane}, nil),
+				kubectlNode("node2", "10.0.0.2", true, "v1.28.2", []string{"disk=ssd"}, []string{"dedicated:NoSchedule"}),
+			},
+			want: []string{"node1 (10.0.0.1): control plane taint is missing, the config keeps it"},
+		},
+		{
+			name: "label and taint",
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", []string{controlPlane}, nil),
+				kubectlNode("node2", "10.0.0.2", true, "v1.28.2", []string{"disk=hdd"}, []string{"dedicated:NoExecute"}),
+			},
+			want: []string{
+				"node2 (10.0.0.2): label disk=ssd is missing",
+				"node2 (10.0.0.2): taint dedicated=db:NoSchedule is missing",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			log := &commandLog{}
+			for _, opts := range [][]node.Option{
+				{node.Address("10.0.0.1"), node.Role([]string{"etcd", "controlplane"}), node.KeepControlPlaneTaint(tt.keep)},
+				{node.Address("10.0.0.2"), node.Role([]string{"worker"}), node.NodeLabels(map[string]string{"disk": "ssd"}), node.Taints([]string{"dedicated=db:NoSchedule"})},
+			} {
+				n, err := node.New(opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				n.SetHostname("node" + strings.TrimPrefix(n.GetAddress(), "10.0.0."))
+				if err := e.AddNode(&fakeNode{Node: n, log: log, reply: kubectlReply(tt.live, nil)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			live, err := e.liveNodes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := problems(e.diffNodes(live)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("diffNodes() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiffHaproxy(t *testing.T) {
+	const header = `global
+    daemon
+frontend kube-apiserver
+    bind *:8443
+    default_backend kube-apiserver
+backend kube-apiserver
+    balance roundrobin
+`
+	tests := []struct {
+		name string
+		cfg  string
+		want []string
+	}{
+		{
+			name: "in sync",
+			cfg:  header + "    server node1 10.0.0.1:6443 check\n    server node2 10.0.0.2:6443 check\n",
+		},
+		{
+			name: "missing",
+			want: []string{"node1 haproxy: /etc/haproxy/haproxy.cfg is missing"},
+		},
+		{
+			name: "missing backend",
+			cfg:  header + "    server node1 10.0.0.1:6443 check\n",
+			want: []string{"node1 haproxy: control plane node2 (10.0.0.2) is not a backend"},
+		},
+		{
+			name: "stale backends",
+			cfg:  header + "    server node1 10.0.0.1:6443 check\n    server node2 10.0.0.2:6443 check\n    server old 10.0.0.8:6443 check\n    server older 10.0.0.9 check\n",
+			want: []string{
+				"node1 haproxy: backend 10.0.0.8 is not a control plane in the config",
+				"node1 haproxy: backend 10.0.0.9 is not a control plane in the config",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := func(hostname, cmd string) (string, error) {
+				if strings.HasPrefix(cmd, "cat /etc/haproxy/haproxy.cfg") {
+					return tt.cfg, nil
+				}
+				return "", nil
+			}
+			e, _ := newFakeEngine(t, nil, reply, "10.0.0.1:etcd,controlplane", "10.0.0.2:controlplane", "10.0.0.3:worker")
+			items, err := e.diffHaproxy(e.nodes[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := problems(items); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("diffHaproxy() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiffHosts(t *testing.T) {
+	const localhost = "127.0.0.1 localhost localhost.localdomain\n::1 localhost ip6-localhost\n"
+	tests := []struct {
+		name  string
+		hosts string
+		want  []string
+	}{
+		{
+			name:  "in sync",
+			hosts: localhost + "10.0.0.1 node1\n10.0.0.2 node2 node2.example.com\n",
+		},
+		{
+			name:  "several addresses",
+			hosts: localhost + "10.0.0.1 node1\n10.0.0.2 node2\n192.168.0.2 node2\n",
+		},
+		{
+			name:  "missing entry",
+			hosts: localhost + "10.0.0.1 node1\n# 10.0.0.2 node2\n",
+			want:  []string{"node1 /etc/hosts: no entry for node2"},
+		},
+		{
+			name:  "wrong address",
+			hosts: localhost + "10.0.0.1 node1\n10.0.0.20 node2 # old\n",
+			want:  []string{"node1 /etc/hosts: node2 resolves to 10.0.0.20, config has 10.0.0.2"},
+		},
+		{
+			name: "empty",
+			want: []string{"node1 /etc/hosts: no entry for node1", "node1 /etc/hosts: no entry for node2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := func(hostname, cmd string) (string, error) {
+				if cmd == "cat /etc/hosts" {
+					return tt.hosts, nil
+				}
+				return "", nil
+			}
+			e, _ := newFakeEngine(t, nil, reply, "10.0.0.1:etcd,controlplane", "10.0.0.2:worker")
+			items, err := e.diffHosts(e.nodes[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := problems(items); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("diffHosts() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
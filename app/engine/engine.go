@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"k8s-tool/app/node"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -35,18 +36,57 @@ type Engine struct {
 	registry struct {
 		hostname string
 	}
-	master     node.Node
-	nodes      []node.Node
-	OnNextStep func(string)
+	cni struct {
+		plugin  cniPlugin
+		podCIDR string
+	}
+	kubeadm struct {
+		version          string
+		pinned           bool
+		imageRepository  string
+		serviceCIDR      string
+		dnsDomain        string
+		certSANs         []string
+		kubeletExtraArgs map[string]string
+	}
+	lb struct {
+		mode    string
+		address string
+		port    uint16
+		kubeVip kubeVipConfig
+	}
+	upgrade  upgradeState
+	selector Selector
+	etcd     struct {
+		snapshot string
+		checksum string
+	}
+	runtime containerRuntime
+	// derivedCRISocket is set when CRISocket was left empty and the
+	// runtime socket is used instead
+	derivedCRISocket bool
+	master           node.Node
+	nodes            []node.Node
+	log              logrus.FieldLogger
+	connected        bool
+	report           Report
+	OnNextStep       func(string)
 }
 
 func New(opts ...Option) (*Engine, error) {
-	e := &Engine{namespace: ""}
+	e := &Engine{namespace: "", log: logrus.StandardLogger(), runtime: runtimes[defaultRuntime]}
+	e.cni.plugin = cniPlugins[defaultCNI]
+	e.lb.mode = lbHaproxy
+	e.upgrade.batch = 1
 	for _, opt := range opts {
 		if err := opt(e); err != nil {
 			return nil, err
 		}
 	}
+	if strings.TrimSpace(e.CRISocket) == "" {
+		e.CRISocket = e.runtime.socket
+		e.derivedCRISocket = true
+	}
 	return e, nil
 }
 
@@ -75,6 +115,21 @@ func (e *Engine) check() error {
 		}
 	}
 
+	if err := e.checkLoadBalancer(); err != nil {
+		return err
+	}
+	if err := e.checkKubeadm(); err != nil {
+		return err
+	}
+	if err := e.checkBundle(); err != nil {
+		return err
+	}
+	if !e.selector.Empty() {
+		if _, err := e.Select(e.selector); err != nil {
+			return err
+		}
+	}
+
 	switch len(e.nodes) {
 	case 0:
 		return errors.New("cluster must have at least one node")
@@ -125,6 +180,7 @@ func (e *Engine) Install(steps string) error {
 				return err
 			}
 		}
+		e.collectVersion()
 		return nil
 	}
 
@@ -133,6 +189,7 @@ func (e *Engine) Install(steps string) error {
 			return err
 		}
 	}
+	e.collectVersion()
 	return nil
 }
 
@@ -159,6 +216,7 @@ func (e *Engine) Update(steps string) error {
 				return err
 			}
 		}
+		e.collectVersion()
 		return nil
 	}
 	for _, step := range UpdateSteps {
@@ -166,9 +224,41 @@ func (e *Engine) Update(steps string) error {
 			return err
 		}
 	}
+	e.collectVersion()
+	return nil
+}
+
+func (e *Engine) Reset(steps string) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	defer e.closeAll()
+	if len(steps) > 0 {
+		nums, err := parseStepNums(steps, len(ResetSteps))
+		if err != nil {
+			return err
+		}
+		nums = prependMissingSteps(nums, 1)
+		for _, n := range nums {
+			if err := ResetSteps[n-1].install(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, step := range ResetSteps {
+		if err := step.install(e); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Validate reports whether the nodes added so far form an installable cluster.
+func (e *Engine) Validate() error {
+	return e.check()
+}
+
 func parseStepNums(raw string, max int) ([]int, error) {
 	var nums []int
 	for _, item := range strings.Split(raw, ",") {
@@ -231,18 +321,40 @@ func (e *Engine) checkNew() error {
 			n.SetIsNew(false)
 		}
 	}
-	return nil
+
+	version, err := e.clusterVersion()
+	if err != nil {
+		return err
+	}
+	if e.kubeadm.pinned && e.kubeadm.version != version {
+		return fmt.Errorf("kubernetesVersion %s differs from the cluster version %s, upgrade the cluster first", e.kubeadm.version, version)
+	}
+	e.kubeadm.version = version
+	return e.checkKubeletVersions(version, false)
 }
 
+// connect connects the master, the load balancer nodes and the targeted
+// nodes. Nodes outside the selector are treated as existing so the per-node
+// steps skip them.
 func (e *Engine) connect() error {
 	var eg errgroup.Group
 	for i := range e.nodes {
 		n := e.nodes[i]
+		if !e.targeted(n) {
+			n.SetIsNew(false)
+			if n != e.master && !e.isLoadBalancer(n) {
+				continue
+			}
+		}
 		eg.Go(func() error {
 			return n.Connect()
 		})
 	}
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	e.connected = true
+	return nil
 }
 
 func (e *Engine) init() error {
@@ -290,24 +402,14 @@ func (e *Engine) installChrony() error {
 			return n.Install("chrony", e.ntp.server, e.ntp.allow, e.ntp.timezone)
 		})
 	}
-	return eg.Wait()
-}
-
-func (e *Engine) installDocker() error {
-	var eg errgroup.Group
-	for i := range e.nodes {
-		n := e.nodes[i]
-		if !n.IsNew() {
-			continue
-		}
-		eg.Go(func() error {
-			return n.Install("docker", e.registry.hostname)
-		})
+	if err := eg.Wait(); err != nil {
+		return err
 	}
-	return eg.Wait()
+	e.installed("chrony")
+	return nil
 }
 
-func (e *Engine) loadDockerImage() error {
+func (e *Engine) installKubeadm() error {
 	var eg errgroup.Group
 	for i := range e.nodes {
 		n := e.nodes[i]
@@ -315,24 +417,23 @@ func (e *Engine) loadDockerImage() error {
 			continue
 		}
 		eg.Go(func() error {
-			return n.Install("docker/images")
+			if err := n.Install(e.kubeadmResource()); err != nil {
+				return err
+			}
+			return e.verifyBundle(n)
 		})
 	}
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	e.installed("kubeadm")
+	return nil
 }
 
-func (e *Engine) installKubeadm() error {
-	var eg errgroup.Group
-	for i := range e.nodes {
-		n := e.nodes[i]
-		if !n.IsNew() {
-			continue
-		}
-		eg.Go(func() error {
-			return n.Install("kubeadm")
-		})
-	}
-	return eg.Wait()
+// isLoadBalancer reports whether n runs haproxy and keepalived. Their config
+// lists every control plane, so they are updated regardless of --nodes.
+func (e *Engine) isLoadBalancer(n node.Node) bool {
+	return e.lb.mode == lbHaproxy && n.IsETCD()
 }
 
 func (e *Engine) installHa() error {
@@ -356,7 +457,11 @@ func (e *Engine) installHa() error {
 			return nil
 		})
 	}
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	e.installed("haproxy")
+	return nil
 }
 
 func (e *Engine) installKeepalived() error {
@@ -397,20 +502,32 @@ func (e *Engine) installKeepalived() error {
 			return nil
 		})
 	}
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	e.installed("keepalived")
+	return nil
 }
+
 func (e *Engine) startK8s() error {
 	e.logCRISocket()
-	args := []string{e.vip, e.master.GetHostname(), e.master.GetAddress()}
-	if e.CRISocket != "" {
-		args = append(args, e.CRISocket)
+	if e.kubeadm.version == "" {
+		out, err := e.master.Run("", "kubeadm version -o short")
+		if err != nil {
+			return err
+		}
+		e.kubeadm.version = strings.TrimSpace(string(out))
 	}
-	res, err := e.master.Run(filepath.Join("resource", "kubeadm"),
-		fmt.Sprintf("bash start.sh %s", strings.Join(args, " ")))
+	dir, err := e.writeKubeadmConfig()
 	if err != nil {
 		return err
 	}
-	logrus.Info(string(res))
+	res, err := e.master.Run(dir,
+		fmt.Sprintf("sudo kubeadm init --config=%s --upload-certs", kubeadmConfigFile))
+	if err != nil {
+		return err
+	}
+	e.log.Info(maskKubeadmOutput(string(res)))
 
 	certKey := parseCertKey(string(res))
 
@@ -420,7 +537,7 @@ func (e *Engine) startK8s() error {
 	if err := e.waitForNodeRegistered(e.master); err != nil {
 		return err
 	}
-	if err := e.removeControlPlaneTaints(e.master.GetHostname()); err != nil {
+	if err := e.labelNode(e.master); err != nil {
 		return err
 	}
 
@@ -458,16 +575,20 @@ func (e *Engine) uploadCerts() (string, error) {
 	}
 	certKey := strings.TrimSpace(string(certKeyBytes))
 
-	if _, err := e.master.Run(filepath.Join("resource", "kubeadm"), fmt.Sprintf(
-		"sudo kubeadm init phase upload-certs --upload-certs --certificate-key=%s --config=kubeadm-config.yaml",
-		certKey)); err != nil {
+	dir, err := e.writeKubeadmConfig()
+	if err != nil {
+		return "", err
+	}
+	if _, err := e.master.Run(dir, fmt.Sprintf(
+		"sudo kubeadm init phase upload-certs --upload-certs --certificate-key=%s --config=%s",
+		certKey, kubeadmConfigFile)); err != nil {
 		return "", err
 	}
 	return certKey, nil
 }
 
 func (e *Engine) configureKubectl(n node.Node) error {
-	if _, err := n.Run(filepath.Join("resource", "kubeadm"), "bash config.sh"); err != nil {
+	if _, err := n.Run(e.kubeadmDir(), "bash config.sh"); err != nil {
 		return fmt.Errorf("%s: configure kubectl: %w", n.GetHostname(), err)
 	}
 	return nil
@@ -493,6 +614,39 @@ func (e *Engine) removeControlPlaneTaints(hostname string) error {
 	return nil
 }
 
+// labelNode applies the configured labels and taints to the registered node
+// n. Control planes lose the control-plane taint unless they keep it.
+func (e *Engine) labelNode(n node.Node) error {
+	hostname := n.GetHostname()
+	if n.IsControl() && !n.KeepControlPlaneTaint() {
+		if err := e.removeControlPlaneTaints(hostname); err != nil {
+			return err
+		}
+	}
+	if labels := n.GetNodeLabels(); len(labels) > 0 {
+		args := make([]string, 0, len(labels))
+		for k, v := range labels {
+			args = append(args, shellQuote(k+"="+v))
+		}
+		sort.Strings(args)
+		if out, err := e.master.Run("", fmt.Sprintf("kubectl label node %s --overwrite %s 2>&1",
+			shellQuote(hostname), strings.Join(args, " "))); err != nil {
+			return fmt.Errorf("%s: label node: %w: %s", hostname, err, out)
+		}
+	}
+	if taints := n.GetTaints(); len(taints) > 0 {
+		args := make([]string, len(taints))
+		for i, t := range taints {
+			args[i] = shellQuote(t)
+		}
+		if out, err := e.master.Run("", fmt.Sprintf("kubectl taint node %s --overwrite %s 2>&1",
+			shellQuote(hostname), strings.Join(args, " "))); err != nil {
+			return fmt.Errorf("%s: taint node: %w: %s", hostname, err, out)
+		}
+	}
+	return nil
+}
+
 func (e *Engine) waitForNodeRegistered(n node.Node) error {
 	hostname := n.GetHostname()
 	deadline := time.Now().Add(nodeJoinTimeout)
@@ -532,16 +686,19 @@ func (e *Engine) nodeNameByInternalIP(addr string) (string, bool) {
 	return name, name != ""
 }
 
-func (e *Engine) kubeadmJoinCommand(n node.Node, baseJoin string, controlPlane bool, certKey string) string {
-	parts := []string{"sudo", baseJoin}
-	if controlPlane {
-		parts = append(parts, "--control-plane", "--certificate-key", certKey)
+// kubeadmJoin joins n with a generated JoinConfiguration, which is removed
+// afterwards as it holds the bootstrap token and certificate key.
+func (e *Engine) kubeadmJoin(n node.Node, baseJoin, certKey string) error {
+	data, err := e.joinConfig(n, baseJoin, certKey)
+	if err != nil {
+		return err
 	}
-	if hostname := strings.TrimSpace(n.GetHostname()); hostname != "" {
-		parts = append(parts, shellQuote("--node-name="+hostname))
+	if err := n.WriteFile(filepath.Join(e.kubeadmResource(), kubeadmJoinFile), data, 0o600); err != nil {
+		return err
 	}
-	parts = append(parts, e.criSocketArg())
-	return strings.TrimRight(strings.Join(parts, " "), " ")
+	_, err = n.Run(e.kubeadmDir(),
+		fmt.Sprintf("sudo kubeadm join --config=%s; rc=$?; rm -f %s; exit $rc", kubeadmJoinFile, kubeadmJoinFile))
+	return err
 }
 
 func (e *Engine) criSocketArg() string {
@@ -555,10 +712,14 @@ func (e *Engine) criSocketArg() string {
 func (e *Engine) logCRISocket() {
 	criSocket := strings.TrimSpace(e.CRISocket)
 	if criSocket == "" {
-		logrus.Warn("cri-socket is empty; kubeadm may fail when multiple CRI endpoints exist on a node")
+		e.log.Warn("cri-socket is empty; kubeadm may fail when multiple CRI endpoints exist on a node")
+		return
+	}
+	if e.derivedCRISocket {
+		e.log.Infof("cri-socket is empty, using the %s runtime socket: %s", e.runtime.name, criSocket)
 		return
 	}
-	logrus.Infof("Using CRI socket: %s", criSocket)
+	e.log.Infof("Using CRI socket: %s", criSocket)
 }
 
 func shellQuote(s string) string {
@@ -586,9 +747,8 @@ func (e *Engine) joinNodes(certKey string) error {
 		if n == e.master || !n.IsNew() || !n.IsControl() {
 			continue
 		}
-		cmd := e.kubeadmJoinCommand(n, baseJoin, true, certKey)
-		logrus.Infof("Joining control-plane node %s with command: %s", n.GetHostname(), maskJoinCommand(cmd))
-		if _, err := n.Run("", cmd); err != nil {
+		e.log.Infof("Joining control-plane node %s", n.GetHostname())
+		if err := e.kubeadmJoin(n, baseJoin, certKey); err != nil {
 			return err
 		}
 		if err := e.waitForNodeRegistered(n); err != nil {
@@ -597,9 +757,14 @@ func (e *Engine) joinNodes(certKey string) error {
 		if err := e.configureKubectl(n); err != nil {
 			return err
 		}
-		if err := e.removeControlPlaneTaints(n.GetHostname()); err != nil {
+		if err := e.labelNode(n); err != nil {
 			return err
 		}
+		if e.lb.mode == lbKubeVip {
+			if err := e.installKubeVip(n); err != nil {
+				return err
+			}
+		}
 	}
 
 	// worker 并行 join
@@ -610,10 +775,8 @@ func (e *Engine) joinNodes(certKey string) error {
 			continue
 		}
 		eg.Go(func() error {
-			cmd := e.kubeadmJoinCommand(n, baseJoin, false, "")
-			logrus.Infof("Joining worker node %s with command: %s", n.GetHostname(), maskJoinCommand(cmd))
-			_, err := n.Run("", cmd)
-			return err
+			e.log.Infof("Joining worker node %s", n.GetHostname())
+			return e.kubeadmJoin(n, baseJoin, "")
 		})
 	}
 	if err := eg.Wait(); err != nil {
@@ -628,52 +791,19 @@ func (e *Engine) joinNodes(certKey string) error {
 		if err := e.waitForNodeRegistered(n); err != nil {
 			return err
 		}
-	}
-	return nil
-}
-
-func maskJoinCommand(cmd string) string {
-	fields := strings.Fields(cmd)
-	for i := range fields {
-		if fields[i] == "--token" && i+1 < len(fields) {
-			fields[i+1] = "****"
-		}
-		if strings.HasPrefix(fields[i], "--token=") {
-			fields[i] = "--token=****"
-		}
-		if fields[i] == "--certificate-key" && i+1 < len(fields) {
-			fields[i+1] = "****"
-		}
-		if strings.HasPrefix(fields[i], "--certificate-key=") {
-			fields[i] = "--certificate-key=****"
+		if err := e.labelNode(n); err != nil {
+			return err
 		}
 	}
-	return strings.Join(fields, " ")
+	return nil
 }
 
-func (e *Engine) installCalico() error {
-	var eg errgroup.Group
-	for i := range e.nodes {
-		n := e.nodes[i]
-		if !n.IsNew() {
-			continue
-		}
-		eg.Go(func() error {
-			return n.Install("calico")
-		})
-	}
-	if err := eg.Wait(); err != nil {
-		return err
-	}
-	_, err := e.master.Run(filepath.Join("resource", "calico"), "kubectl apply -f calico.yaml")
-	if err != nil {
+func (e *Engine) installHelm() error {
+	if err := e.master.Install("helm"); err != nil {
 		return err
 	}
-	return e.waitForClusterNetworkReady()
-}
-
-func (e *Engine) installHelm() error {
-	return e.master.Install("helm")
+	e.installed("helm")
+	return nil
 }
 
 func (e *Engine) installNFSUtils() error {
@@ -687,7 +817,11 @@ func (e *Engine) installNFSUtils() error {
 			return n.Install("nfs/nfs-utils")
 		})
 	}
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	e.installed("nfs-utils")
+	return nil
 }
 
 func (e *Engine) installNFS() error {
@@ -698,7 +832,11 @@ func (e *Engine) installNFS() error {
 	if e.nfs.server == "" {
 		return nil
 	}
-	return e.master.Install("nfs", e.nfs.server, e.nfs.path, e.namespace)
+	if err := e.master.Install("nfs", e.nfs.server, e.nfs.path, e.namespace); err != nil {
+		return err
+	}
+	e.installed("nfs")
+	return nil
 }
 
 func (e *Engine) installIstio() error {
@@ -713,7 +851,7 @@ func (e *Engine) installIstio() error {
 			continue
 		}
 		eg.Go(func() error {
-			return n.Install("istio/images")
+			return e.loadImages(n, "istio/images")
 		})
 	}
 	if err := eg.Wait(); err != nil {
@@ -721,7 +859,7 @@ func (e *Engine) installIstio() error {
 	}
 	installErr := e.master.InstallWithTimeout("istio", istioInstallTimeout)
 	if installErr != nil {
-		logrus.Warnf("istio install did not complete cleanly: %v", installErr)
+		e.log.Warnf("istio install did not complete cleanly: %v", installErr)
 	}
 	if err := e.ensureIstioReady(installErr != nil); err != nil {
 		if installErr != nil {
@@ -729,32 +867,30 @@ func (e *Engine) installIstio() error {
 		}
 		return err
 	}
+	e.installed("istio")
 	return nil
 }
 
 func (e *Engine) waitForClusterNetworkReady() error {
-	checks := []struct {
-		name string
-		cmd  string
-	}{
-		{
-			name: "calico-node daemonset",
-			cmd:  "kubectl -n kube-system rollout status daemonset/calico-node --timeout=5m",
-		},
-		{
-			name: "all nodes Ready",
-			cmd:  "kubectl wait --for=condition=Ready nodes --all --timeout=5m",
-		},
-		{
+	if e.cni.plugin.manifest == "" {
+		return nil
+	}
+	checks := append(append([]readinessCheck{}, e.cni.plugin.checks...),
+		nodesReadyCheck,
+		readinessCheck{
 			name: "CoreDNS deployment",
 			cmd:  "kubectl -n kube-system rollout status deployment/coredns --timeout=5m",
 		},
-	}
+	)
+	return e.runChecks(checks...)
+}
+
+func (e *Engine) runChecks(checks ...readinessCheck) error {
 	for _, check := range checks {
-		logrus.Infof("Waiting for %s", check.name)
+		e.log.Infof("Waiting for %s", check.name)
 		out, err := e.master.Run("", check.cmd)
 		if len(out) > 0 {
-			logrus.Info(string(out))
+			e.log.Info(string(out))
 		}
 		if err != nil {
 			return fmt.Errorf("%s is not ready: %w", check.name, err)
@@ -770,7 +906,7 @@ func (e *Engine) ensureIstioReady(restartFirst bool) error {
 		}
 	}
 	if err := e.waitForIstiodReady(); err != nil {
-		logrus.Warnf("istiod is not ready, restarting it: %v", err)
+		e.log.Warnf("istiod is not ready, restarting it: %v", err)
 		if restartErr := e.restartIstiod(); restartErr != nil {
 			return restartErr
 		}
@@ -779,7 +915,7 @@ func (e *Engine) ensureIstioReady(restartFirst bool) error {
 		}
 	}
 	if err := e.waitForIstioGatewayReady(); err != nil {
-		logrus.Warnf("istio ingress gateway is not ready, restarting istiod: %v", err)
+		e.log.Warnf("istio ingress gateway is not ready, restarting istiod: %v", err)
 		if restartErr := e.restartIstiod(); restartErr != nil {
 			return restartErr
 		}
@@ -792,10 +928,10 @@ func (e *Engine) ensureIstioReady(restartFirst bool) error {
 }
 
 func (e *Engine) restartIstiod() error {
-	logrus.Warn("Restarting istiod deployment")
+	e.log.Warn("Restarting istiod deployment")
 	out, err := e.master.Run("", "kubectl -n istio-system rollout restart deployment/istiod")
 	if len(out) > 0 {
-		logrus.Info(string(out))
+		e.log.Info(string(out))
 	}
 	if err != nil {
 		return fmt.Errorf("restart istiod: %w", err)
@@ -815,7 +951,7 @@ func (e *Engine) waitForIstiodEndpoints() error {
 	for {
 		out, err := e.master.Run("", "kubectl -n istio-system get endpoints istiod -o jsonpath='{.subsets[*].addresses[*].ip}'")
 		if err == nil && strings.TrimSpace(string(out)) != "" {
-			logrus.Infof("istiod endpoints: %s", strings.TrimSpace(string(out)))
+			e.log.Infof("istiod endpoints: %s", strings.TrimSpace(string(out)))
 			return nil
 		}
 		if time.Now().After(deadline) {
@@ -833,10 +969,10 @@ func (e *Engine) waitForIstioGatewayReady() error {
 }
 
 func (e *Engine) runAndLog(name, cmd string) error {
-	logrus.Infof("Waiting for %s", name)
+	e.log.Infof("Waiting for %s", name)
 	out, err := e.master.Run("", cmd)
 	if len(out) > 0 {
-		logrus.Info(string(out))
+		e.log.Info(string(out))
 	}
 	if err != nil {
 		return fmt.Errorf("%s: %w", name, err)
@@ -852,7 +988,7 @@ func (e *Engine) installApp() error {
 			continue
 		}
 		eg.Go(func() error {
-			return n.Install("app/images")
+			return e.loadImages(n, "app/images")
 		})
 	}
 	if err := eg.Wait(); err != nil {
@@ -861,6 +997,35 @@ func (e *Engine) installApp() error {
 	if err := e.master.Install("app"); err != nil {
 		return err
 	}
+	e.installed("app")
+	if e.lb.mode != lbHaproxy {
+		return nil
+	}
+	return e.startKeepalivedBackups()
+}
+
+// updateLoadBalancer rewrites haproxy and keepalived on every load balancer
+// node when update added a control plane or a load balancer node.
+func (e *Engine) updateLoadBalancer() error {
+	if e.lb.mode != lbHaproxy {
+		return nil
+	}
+	changed := false
+	for _, n := range e.nodes {
+		if n.IsNew() && (n.IsControl() || n.IsETCD()) {
+			changed = true
+		}
+	}
+	if !changed {
+		e.log.Info("No new control plane or load balancer node, skip load balancer")
+		return nil
+	}
+	if err := e.installHa(); err != nil {
+		return err
+	}
+	if err := e.installKeepalived(); err != nil {
+		return err
+	}
 	return e.startKeepalivedBackups()
 }
 
@@ -879,6 +1044,19 @@ func (e *Engine) startKeepalivedBackups() error {
 }
 
 func (e *Engine) join() error {
+	e.logCRISocket()
+	version := e.kubeadm.version
+	if version == "" {
+		var err error
+		if version, err = e.clusterVersion(); err != nil {
+			return err
+		}
+	}
+	if err := e.checkKubeletVersions(version, true); err != nil {
+		return err
+	}
+	e.kubeadm.version = version
+
 	// 新节点先并行加载镜像
 	var eg errgroup.Group
 	for i := range e.nodes {
@@ -887,13 +1065,13 @@ func (e *Engine) join() error {
 			continue
 		}
 		eg.Go(func() error {
-			if err := n.Install("docker/images"); err != nil {
+			if err := e.loadImages(n, e.runtime.images); err != nil {
 				return err
 			}
-			if err := n.Install("istio/images"); err != nil {
+			if err := e.loadImages(n, "istio/images"); err != nil {
 				return err
 			}
-			return n.Install("app/images")
+			return e.loadImages(n, "app/images")
 		})
 	}
 	if err := eg.Wait(); err != nil {
@@ -902,3 +1080,60 @@ func (e *Engine) join() error {
 
 	return e.joinNodes("")
 }
+
+func (e *Engine) resetK8s() error {
+	// worker 先并行 reset，control-plane 最后逐个 reset，master 放在最后
+	var eg errgroup.Group
+	for i := range e.nodes {
+		n := e.nodes[i]
+		if n.IsControl() || !e.targeted(n) {
+			continue
+		}
+		eg.Go(func() error {
+			return e.resetNode(n)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	for i := range e.nodes {
+		n := e.nodes[i]
+		if n == e.master || !n.IsControl() || !e.targeted(n) {
+			continue
+		}
+		if err := e.resetNode(n); err != nil {
+			return err
+		}
+	}
+	if !e.targeted(e.master) {
+		return nil
+	}
+	return e.resetNode(e.master)
+}
+
+func (e *Engine) resetNode(n node.Node) error {
+	cmd := strings.TrimRight(fmt.Sprintf("sudo kubeadm reset -f %s", e.criSocketArg()), " ")
+	e.log.Infof("Resetting node %s", n.GetHostname())
+	if _, err := n.Run("", cmd, "rm -rf $HOME/.kube"); err != nil {
+		return fmt.Errorf("%s: reset: %w", n.GetHostname(), err)
+	}
+	return nil
+}
+
+func (e *Engine) stopLoadBalancer() error {
+	if e.lb.mode != lbHaproxy {
+		return nil
+	}
+	var eg errgroup.Group
+	for i := range e.nodes {
+		n := e.nodes[i]
+		if !n.IsETCD() || !e.targeted(n) {
+			continue
+		}
+		eg.Go(func() error {
+			_, err := n.Run("", "sudo systemctl disable --now keepalived haproxy 2>/dev/null || true")
+			return err
+		})
+	}
+	return eg.Wait()
+}
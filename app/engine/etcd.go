@@ -0,0 +1,308 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"k8s-tool/app/node"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	etcdSnapshotPrefix = "etcd-snapshot-"
+	etcdRestoreDir     = "/var/lib/etcd-restore"
+)
+
+// etcdctlFlags connects to the local stacked etcd with the kubeadm certs.
+const etcdctlFlags = "--endpoints=https://127.0.0.1:2379" +
+	" --cacert=/etc/kubernetes/pki/etcd/ca.crt" +
+	" --cert=/etc/kubernetes/pki/etcd/healthcheck-client.crt" +
+	" --key=/etc/kubernetes/pki/etcd/healthcheck-client.key"
+
+// restore
+var RestoreSteps = []*Step{
+	{Num: 1, Name: "connect", run: func(e *Engine) error { return e.connect() }},
+	{Num: 2, Name: "upload snapshot", run: func(e *Engine) error { return e.uploadSnapshot() }},
+	{Num: 3, Name: "stop control plane", run: func(e *Engine) error { return e.stopControlPlane() }},
+	{Num: 4, Name: "restore etcd data", run: func(e *Engine) error { return e.restoreEtcdData() }},
+	{Num: 5, Name: "start control plane", run: func(e *Engine) error { return e.startControlPlane() }},
+}
+
+// BackupEtcd snapshots etcd on the master, downloads the snapshot into dir
+// next to a sha256 checksum file and keeps the newest keep snapshots there
+// (all of them when keep is 0). It returns the local snapshot path.
+func (e *Engine) BackupEtcd(dir string, keep int) (string, error) {
+	if err := e.connectMaster(); err != nil {
+		return "", err
+	}
+	defer e.closeAll()
+
+	name := etcdSnapshotPrefix + time.Now().Format("20060102-150405") + ".db"
+	remote := "/var/lib/etcd/" + name
+	e.log.Infof("Saving etcd snapshot on %s", e.master.GetHostname())
+	out, err := e.master.Run("", fmt.Sprintf(
+		"if command -v etcdctl >/dev/null 2>&1; then sudo etcdctl %s snapshot save %s; "+
+			"else kubectl -n kube-system exec %s -- etcdctl %s snapshot save %s; fi",
+		etcdctlFlags, remote, shellQuote("etcd-"+e.master.GetHostname()), etcdctlFlags, remote))
+	e.log.Info(string(out))
+	if err != nil {
+		return "", err
+	}
+	if _, err := e.master.Run("", fmt.Sprintf("sudo mv %s ~/%s", remote, name),
+		fmt.Sprintf("sudo chown $(id -u):$(id -g) ~/%s", name)); err != nil {
+		return "", err
+	}
+	defer e.master.Run("", fmt.Sprintf("rm -f ~/%s", name))
+
+	out, err = e.master.Run("", fmt.Sprintf("sha256sum ~/%s", name))
+	if err != nil {
+		return "", err
+	}
+	remoteSum, _, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+
+	local := filepath.Join(dir, name)
+	if err := e.master.Download("~/"+name, local); err != nil {
+		return "", err
+	}
+	sum, err := fileChecksum(local)
+	if err != nil {
+		return "", err
+	}
+	if sum != remoteSum {
+		os.Remove(local)
+		return "", fmt.Errorf("snapshot checksum mismatch: %s on %s, %s downloaded", remoteSum, e.master.GetHostname(), sum)
+	}
+	if err := os.WriteFile(local+".sha256", []byte(sum+"  "+name+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	e.log.Infof("Saved etcd snapshot %s (sha256 %s)", local, sum)
+	return local, pruneSnapshots(dir, keep, e.log.Infof)
+}
+
+// pruneSnapshots deletes all but the newest keep snapshots in dir.
+func pruneSnapshots(dir string, keep int, logf func(string, ...any)) error {
+	if keep <= 0 {
+		return nil
+	}
+	snapshots, err := filepath.Glob(filepath.Join(dir, etcdSnapshotPrefix+"*.db"))
+	if err != nil {
+		return err
+	}
+	// 时间戳格式保证按名称排序即按时间排序
+	sort.Strings(snapshots)
+	for len(snapshots) > keep {
+		logf("Removing old etcd snapshot %s", snapshots[0])
+		if err := os.Remove(snapshots[0]); err != nil {
+			return err
+		}
+		if err := os.Remove(snapshots[0] + ".sha256"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		snapshots = snapshots[1:]
+	}
+	return nil
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifySnapshot compares the snapshot with its .sha256 file, if any, and
+// returns its checksum.
+func verifySnapshot(path string) (string, error) {
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path + ".sha256")
+	if os.IsNotExist(err) {
+		return sum, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	want, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	if want != sum {
+		return "", fmt.Errorf("%s: checksum %s does not match %s.sha256", path, sum, path)
+	}
+	return sum, nil
+}
+
+// RestoreEtcd restores every etcd member from snapshot. The control plane
+// is down between steps 3 and 5; a failed step can be resumed with steps.
+func (e *Engine) RestoreEtcd(snapshot string, steps string) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if err := e.checkEtcdMembers(); err != nil {
+		return err
+	}
+	sum, err := verifySnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	e.etcd.snapshot = snapshot
+	e.etcd.checksum = sum
+	defer e.closeAll()
+	if len(steps) > 0 {
+		nums, err := parseStepNums(steps, len(RestoreSteps))
+		if err != nil {
+			return err
+		}
+		nums = prependMissingSteps(nums, 1)
+		for _, n := range nums {
+			if err := RestoreSteps[n-1].install(e); err != nil {
+				return fmt.Errorf("%w; fix it and resume with --step %d", err, n)
+			}
+		}
+		return nil
+	}
+	for _, step := range RestoreSteps {
+		if err := step.install(e); err != nil {
+			return fmt.Errorf("%w; fix it and resume with --step %d", err, step.Num)
+		}
+	}
+	return nil
+}
+
+// etcdMembers are the control plane nodes, each running a stacked etcd.
+func (e *Engine) etcdMembers() []node.Node {
+	var members []node.Node
+	for _, n := range e.nodes {
+		if n.IsControl() {
+			members = append(members, n)
+		}
+	}
+	return members
+}
+
+// checkEtcdMembers makes sure the etcd role matches the control planes, as
+// the restore rebuilds the stacked etcd of kubeadm on every control plane.
+func (e *Engine) checkEtcdMembers() error {
+	for _, n := range e.nodes {
+		switch {
+		case n.IsControl() && !n.IsETCD():
+			return fmt.Errorf("%s: control plane without the etcd role, restore needs the etcd nodes to be the control planes", n.GetHostname())
+		case n.IsETCD() && !n.IsControl():
+			return fmt.Errorf("%s: etcd node without the controlplane role, restore only supports the stacked etcd of the control planes", n.GetHostname())
+		}
+	}
+	return nil
+}
+
+func (e *Engine) remoteSnapshot() string {
+	return "~/etcd-restore/" + filepath.Base(e.etcd.snapshot)
+}
+
+func (e *Engine) uploadSnapshot() error {
+	var eg errgroup.Group
+	for _, n := range e.etcdMembers() {
+		eg.Go(func() error {
+			if err := n.Upload(e.etcd.snapshot, e.remoteSnapshot()); err != nil {
+				return err
+			}
+			out, err := n.Run("", fmt.Sprintf("sha256sum %s", e.remoteSnapshot()))
+			if err != nil {
+				return err
+			}
+			if sum, _, _ := strings.Cut(strings.TrimSpace(string(out)), " "); sum != e.etcd.checksum {
+				return fmt.Errorf("%s: uploaded snapshot checksum %s, want %s", n.GetHostname(), sum, e.etcd.checksum)
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+// stopControlPlane stops etcd and the API server on every member.
+func (e *Engine) stopControlPlane() error {
+	var eg errgroup.Group
+	for _, n := range e.etcdMembers() {
+		eg.Go(func() error {
+			e.log.Infof("Stopping etcd and kube-apiserver on %s", n.GetHostname())
+			return stopStaticPods(n, "etcd", "kube-apiserver")
+		})
+	}
+	return eg.Wait()
+}
+
+func (e *Engine) restoreEtcdData() error {
+	members := e.etcdMembers()
+	var cluster []string
+	for _, n := range members {
+		cluster = append(cluster, fmt.Sprintf("%s=https://%s:2380", n.GetHostname(), n.GetAddress()))
+	}
+	initialCluster := strings.Join(cluster, ",")
+	backup := "/var/lib/etcd.bak-" + time.Now().Format("20060102-150405")
+
+	_, err := os.Stat(filepath.Join("resource", "etcd"))
+	hasBundle := err == nil
+
+	var eg errgroup.Group
+	for _, n := range members {
+		eg.Go(func() error {
+			path := ""
+			if hasBundle {
+				dir, err := n.UploadResource("etcd")
+				if err != nil {
+					return err
+				}
+				path = fmt.Sprintf(`export PATH="$HOME/%s:$PATH"; `, dir)
+			}
+			e.log.Infof("Restoring etcd data on %s, old data is kept in %s", n.GetHostname(), backup)
+			out, err := n.Run("",
+				path+`bin=$(command -v etcdutl || command -v etcdctl) || { echo "etcdutl or etcdctl not found, install it or put it in resource/etcd" >&2; exit 1; }`,
+				fmt.Sprintf("sudo rm -rf %s", etcdRestoreDir),
+				fmt.Sprintf("sudo $bin snapshot restore %s --name %s --initial-cluster %s --initial-advertise-peer-urls https://%s:2380 --data-dir %s",
+					e.remoteSnapshot(), shellQuote(n.GetHostname()), shellQuote(initialCluster), n.GetAddress(), etcdRestoreDir),
+				fmt.Sprintf("if [ -e /var/lib/etcd ]; then sudo mv /var/lib/etcd %s; fi", backup),
+				fmt.Sprintf("sudo mv %s /var/lib/etcd", etcdRestoreDir),
+			)
+			e.log.Info(string(out))
+			if err != nil {
+				return fmt.Errorf("%s: restore etcd: %w", n.GetHostname(), err)
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+// startControlPlane starts the stopped static pods, waits for the API
+// server and the nodes and removes the uploaded snapshot.
+func (e *Engine) startControlPlane() error {
+	var eg errgroup.Group
+	for _, n := range e.etcdMembers() {
+		eg.Go(func() error {
+			return startStaticPods(n)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	if err := e.runChecks(apiServerReadyCheck, nodesReadyCheck); err != nil {
+		return err
+	}
+	for _, n := range e.etcdMembers() {
+		if _, err := n.Run("", fmt.Sprintf("rm -f %s", e.remoteSnapshot()), "rmdir ~/etcd-restore 2>/dev/null || true"); err != nil {
+			e.log.Warnf("%s: remove snapshot: %v", n.GetHostname(), err)
+		}
+	}
+	return nil
+}
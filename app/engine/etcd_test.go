@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestEngine builds an engine from address:role,role specs without
+// connecting to any node.
+func newTestEngine(t *testing.T, opts []Option, specs ...string) *Engine {
+	t.Helper()
+	e, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, spec := range specs {
+		addr, roles, _ := strings.Cut(spec, ":")
+		if err := e.AddNode(testNode(t, addr, fmt.Sprintf("node%d", i+1), roles, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e
+}
+
+func TestCheckEtcdMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []string
+		wantErr bool
+	}{
+		{name: "stacked", nodes: []string{"10.0.0.1:etcd,controlplane", "10.0.0.2:etcd,controlplane,worker", "10.0.0.3:worker"}},
+		{name: "control plane without etcd", nodes: []string{"10.0.0.1:etcd,controlplane", "10.0.0.2:controlplane"}, wantErr: true},
+		{name: "etcd only", nodes: []string{"10.0.0.1:etcd,controlplane", "10.0.0.2:etcd"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, nil, tt.nodes...)
+			if err := e.checkEtcdMembers(); (err != nil) != tt.wantErr {
+				t.Fatalf("checkEtcdMembers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func writeSnapshot(t *testing.T, path, content, sum string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if sum == "" {
+		return
+	}
+	if err := os.WriteFile(path+".sha256", []byte(sum+"  "+filepath.Base(path)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	names := []string{
+		"etcd-snapshot-20240101-120000.db",
+		"etcd-snapshot-20240102-120000.db",
+		"etcd-snapshot-20240103-120000.db",
+	}
+	tests := []struct {
+		name string
+		keep int
+		want []string
+	}{
+		{name: "keep two", keep: 2, want: []string{names[1], names[1] + ".sha256", names[2], names[2] + ".sha256", "other.db"}},
+		{name: "keep more than present", keep: 5, want: []string{names[0], names[0] + ".sha256", names[1], names[1] + ".sha256", names[2], names[2] + ".sha256", "other.db"}},
+		{name: "zero keeps all", keep: 0, want: []string{names[0], names[0] + ".sha256", names[1], names[1] + ".sha256", names[2], names[2] + ".sha256", "other.db"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range names {
+				writeSnapshot(t, filepath.Join(dir, name), name, "0")
+			}
+			writeSnapshot(t, filepath.Join(dir, "other.db"), "other", "")
+			if err := pruneSnapshots(dir, tt.keep, t.Logf); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("pruneSnapshots() left %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	// sha256 of "snapshot"
+	sum := "16a0eeb0791b6c92451fd284dd9f599e0a7dbe7f6ebea6e2d2d06c7f74aec112"
+	dir := t.TempDir()
+	path := filepath.Join(dir, "etcd-snapshot-20240101-120000.db")
+	writeSnapshot(t, path, "snapshot", "")
+	tests := []struct {
+		name    string
+		sumFile string
+		wantErr bool
+	}{
+		{name: "no checksum file", sumFile: ""},
+		{name: "matching checksum", sumFile: sum + "  etcd-snapshot-20240101-120000.db\n"},
+		{name: "bare checksum", sumFile: sum},
+		{name: "mismatched checksum", sumFile: strings.Repeat("0", 64) + "  etcd-snapshot-20240101-120000.db\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(path + ".sha256")
+			if tt.sumFile != "" {
+				if err := os.WriteFile(path+".sha256", []byte(tt.sumFile), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := verifySnapshot(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifySnapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != sum {
+				t.Fatalf("verifySnapshot() = %q, want %q", got, sum)
+			}
+		})
+	}
+	if _, err := verifySnapshot(filepath.Join(dir, "missing.db")); err == nil {
+		t.Fatal("verifySnapshot() on missing file error = nil")
+	}
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
+)
+
+// ExecResult is the output of a command on one node. ExitCode is -1 when the
+// command could not be run at all, Err then says why.
+type ExecResult struct {
+	Node     string
+	Output   string
+	ExitCode int
+	Err      error
+}
+
+// ExecGroup is the nodes that printed the same output with the same exit code.
+type ExecGroup struct {
+	Nodes    []string
+	Output   string
+	ExitCode int
+}
+
+// Exec runs command on the nodes matching s concurrently and returns the
+// combined stdout and stderr of each node in config order. Nodes that cannot
+// be reached are reported in their result instead of failing the others.
+func (e *Engine) Exec(s Selector, command string) ([]ExecResult, error) {
+	nodes, err := e.Select(s)
+	if err != nil {
+		return nil, err
+	}
+	defer e.closeAll()
+
+	results := make([]ExecResult, len(nodes))
+	var eg errgroup.Group
+	for i, n := range nodes {
+		eg.Go(func() error {
+			r := ExecResult{Node: nodeName(n), ExitCode: -1}
+			defer func() { results[i] = r }()
+			if err := n.Connect(); err != nil {
+				r.Err = fmt.Errorf("connect: %w", err)
+				return nil
+			}
+			out, err := n.Run("", fmt.Sprintf("{\n%s\n} 2>&1", command))
+			r.Output = string(out)
+			var exit *ssh.ExitError
+			switch {
+			case err == nil:
+				r.ExitCode = 0
+			case errors.As(err, &exit):
+				r.ExitCode = exit.ExitStatus()
+			default:
+				r.Err = err
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+	return results, nil
+}
+
+// GroupExecResults collapses the results with identical output and exit code,
+// like dshbak -c. Groups are ordered by their first node.
+func GroupExecResults(results []ExecResult) []ExecGroup {
+	var (
+		groups []ExecGroup
+		index  = map[string]int{}
+	)
+	for _, r := range results {
+		output := r.Output
+		if r.Err != nil {
+			output = strings.TrimRight(output+r.Err.Error(), "\n") + "\n"
+		}
+		key := fmt.Sprintf("%d\x00%s", r.ExitCode, output)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, ExecGroup{Output: output, ExitCode: r.ExitCode})
+		}
+		groups[i].Nodes = append(groups[i].Nodes, r.Node)
+	}
+	return groups
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGroupExecResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []ExecResult
+		want    []ExecGroup
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "same output",
+			results: []ExecResult{
+				{Node: "node1", Output: "ok\n"},
+				{Node: "node2", Output: "ok\n"},
+			},
+			want: []ExecGroup{{Nodes: []string{"node1", "node2"}, Output: "ok\n"}},
+		},
+		{
+			name: "ordered by first node",
+			results: []ExecResult{
+				{Node: "node1", Output: "a\n"},
+				{Node: "node2", Output: "b\n"},
+				{Node: "node3", Output: "a\n"},
+			},
+			want: []ExecGroup{
+				{Nodes: []string{"node1", "node3"}, Output: "a\n"},
+				{Nodes: []string{"node2"}, Output: "b\n"},
+			},
+		},
+		{
+			name: "exit code splits groups",
+			results: []ExecResult{
+				{Node: "node1", Output: "missing\n", ExitCode: 1},
+				{Node: "node2", Output: "missing\n"},
+			},
+			want: []ExecGroup{
+				{Nodes: []string{"node1"}, Output: "missing\n", ExitCode: 1},
+				{Nodes: []string{"node2"}, Output: "missing\n"},
+			},
+		},
+		{
+			name: "unreachable nodes",
+			results: []ExecResult{
+				{Node: "node1", ExitCode: -1, Err: errors.New("dial tcp: i/o timeout")},
+				{Node: "node2", ExitCode: -1, Err: errors.New("dial tcp: i/o timeout\n")},
+				{Node: "node3", Output: "ok\n"},
+			},
+			want: []ExecGroup{
+				{Nodes: []string{"node1", "node2"}, Output: "dial tcp: i/o timeout\n", ExitCode: -1},
+				{Nodes: []string{"node3"}, Output: "ok\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GroupExecResults(tt.results); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("GroupExecResults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
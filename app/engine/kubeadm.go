@@ -0,0 +1,298 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"k8s-tool/app/node"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	kubeadmAPIVersion = "kubeadm.k8s.io/v1beta3"
+	kubeadmConfigFile = "kubeadm-config.yaml"
+	kubeadmJoinFile   = "kubeadm-join.yaml"
+	apiServerPort     = 6443
+	// defaultServiceCIDR is the service subnet of kubeadm when none is set
+	defaultServiceCIDR = "10.96.0.0/12"
+)
+
+var dnsNamePattern = regexp.MustCompile(`^(\*\.)?[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+var (
+	secretFlagPattern     = regexp.MustCompile(`(--token|--certificate-key)([ =])\S+`)
+	bootstrapTokenPattern = regexp.MustCompile(`\b[a-z0-9]{6}\.[a-z0-9]{16}\b`)
+)
+
+type apiEndpoint struct {
+	AdvertiseAddress string `yaml:"advertiseAddress,omitempty"`
+	BindPort         int    `yaml:"bindPort,omitempty"`
+}
+
+type nodeRegistration struct {
+	Name             string            `yaml:"name,omitempty"`
+	CRISocket        string            `yaml:"criSocket,omitempty"`
+	KubeletExtraArgs map[string]string `yaml:"kubeletExtraArgs,omitempty"`
+}
+
+type initConfiguration struct {
+	APIVersion       string           `yaml:"apiVersion"`
+	Kind             string           `yaml:"kind"`
+	LocalAPIEndpoint apiEndpoint      `yaml:"localAPIEndpoint"`
+	NodeRegistration nodeRegistration `yaml:"nodeRegistration"`
+}
+
+type networking struct {
+	PodSubnet     string `yaml:"podSubnet,omitempty"`
+	ServiceSubnet string `yaml:"serviceSubnet,omitempty"`
+	DNSDomain     string `yaml:"dnsDomain,omitempty"`
+}
+
+type apiServer struct {
+	CertSANs []string `yaml:"certSANs,omitempty"`
+}
+
+type clusterConfiguration struct {
+	APIVersion           string     `yaml:"apiVersion"`
+	Kind                 string     `yaml:"kind"`
+	KubernetesVersion    string     `yaml:"kubernetesVersion,omitempty"`
+	ControlPlaneEndpoint string     `yaml:"controlPlaneEndpoint,omitempty"`
+	ImageRepository      string     `yaml:"imageRepository,omitempty"`
+	Networking           networking `yaml:"networking"`
+	APIServer            apiServer  `yaml:"apiServer"`
+}
+
+type bootstrapTokenDiscovery struct {
+	APIServerEndpoint string   `yaml:"apiServerEndpoint"`
+	Token             string   `yaml:"token"`
+	CACertHashes      []string `yaml:"caCertHashes"`
+}
+
+type joinControlPlane struct {
+	LocalAPIEndpoint apiEndpoint `yaml:"localAPIEndpoint"`
+	CertificateKey   string      `yaml:"certificateKey"`
+}
+
+type joinConfiguration struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Discovery  struct {
+		BootstrapToken bootstrapTokenDiscovery `yaml:"bootstrapToken"`
+	} `yaml:"discovery"`
+	NodeRegistration nodeRegistration  `yaml:"nodeRegistration"`
+	ControlPlane     *joinControlPlane `yaml:"controlPlane,omitempty"`
+}
+
+// checkKubeadm validates the settings that end up in the kubeadm config.
+func (e *Engine) checkKubeadm() error {
+	cidr := e.kubeadm.serviceCIDR
+	if cidr == "" {
+		cidr = defaultServiceCIDR
+	}
+	_, svc, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid service cidr: %w", err)
+	}
+	if pod := e.podCIDR(); pod != "" {
+		if _, p, err := net.ParseCIDR(pod); err == nil && (p.Contains(svc.IP) || svc.Contains(p.IP)) {
+			return fmt.Errorf("service cidr %s overlaps pod cidr %s", cidr, pod)
+		}
+	}
+	for _, san := range e.kubeadm.certSANs {
+		if net.ParseIP(san) == nil && !dnsNamePattern.MatchString(san) {
+			return fmt.Errorf("invalid cert SAN %q: must be an IP address or DNS name", san)
+		}
+	}
+	for k := range e.kubeadm.kubeletExtraArgs {
+		if k == "" || strings.HasPrefix(k, "-") {
+			return fmt.Errorf("invalid kubelet extra arg %q: use the flag name without leading dashes", k)
+		}
+	}
+	return nil
+}
+
+// imageRepository is where kubeadm pulls the control plane images from.
+func (e *Engine) imageRepository() string {
+	if e.kubeadm.imageRepository != "" {
+		return e.kubeadm.imageRepository
+	}
+	if e.registry.hostname != "" {
+		return e.registry.hostname + "/google_containers"
+	}
+	return ""
+}
+
+// certSANs lists the extra API server certificate names: the endpoint, every
+// control plane node and the configured SANs.
+func (e *Engine) certSANs() []string {
+	var sans []string
+	add := func(s string) {
+		if s == "" {
+			return
+		}
+		for _, v := range sans {
+			if v == s {
+				return
+			}
+		}
+		sans = append(sans, s)
+	}
+	add(e.vip)
+	if e.lb.mode == lbExternal {
+		add(e.lb.address)
+	}
+	for _, n := range e.nodes {
+		if n.IsControl() {
+			add(n.GetAddress())
+			add(n.GetHostname())
+		}
+	}
+	for _, s := range e.kubeadm.certSANs {
+		add(s)
+	}
+	return sans
+}
+
+// KubeadmConfig renders the kubeadm init configuration of the master.
+func (e *Engine) KubeadmConfig() ([]byte, error) {
+	if e.master == nil {
+		return nil, errors.New("cluster doesn't have control plane node")
+	}
+	if err := e.checkKubeadm(); err != nil {
+		return nil, err
+	}
+	initCfg := initConfiguration{
+		APIVersion: kubeadmAPIVersion,
+		Kind:       "InitConfiguration",
+		LocalAPIEndpoint: apiEndpoint{
+			AdvertiseAddress: e.master.GetAddress(),
+			BindPort:         apiServerPort,
+		},
+		NodeRegistration: e.nodeRegistration(e.master),
+	}
+	cluster := clusterConfiguration{
+		APIVersion:           kubeadmAPIVersion,
+		Kind:                 "ClusterConfiguration",
+		KubernetesVersion:    e.kubeadm.version,
+		ControlPlaneEndpoint: e.controlPlaneEndpoint(),
+		ImageRepository:      e.imageRepository(),
+		Networking: networking{
+			PodSubnet:     e.podCIDR(),
+			ServiceSubnet: e.kubeadm.serviceCIDR,
+			DNSDomain:     e.kubeadm.dnsDomain,
+		},
+		APIServer: apiServer{CertSANs: e.certSANs()},
+	}
+	return marshalDocuments(initCfg, cluster)
+}
+
+func (e *Engine) nodeRegistration(n node.Node) nodeRegistration {
+	return nodeRegistration{
+		Name:             n.GetHostname(),
+		CRISocket:        criSocketURL(e.CRISocket),
+		KubeletExtraArgs: e.kubeadm.kubeletExtraArgs,
+	}
+}
+
+// joinConfig renders the kubeadm join configuration of n. joinCmd is the
+// output of `kubeadm token create --print-join-command`.
+func (e *Engine) joinConfig(n node.Node, joinCmd, certKey string) ([]byte, error) {
+	discovery, err := parseJoinCommand(joinCmd)
+	if err != nil {
+		return nil, err
+	}
+	c := joinConfiguration{
+		APIVersion:       kubeadmAPIVersion,
+		Kind:             "JoinConfiguration",
+		NodeRegistration: e.nodeRegistration(n),
+	}
+	c.Discovery.BootstrapToken = discovery
+	if n.IsControl() {
+		c.ControlPlane = &joinControlPlane{
+			LocalAPIEndpoint: apiEndpoint{AdvertiseAddress: n.GetAddress(), BindPort: apiServerPort},
+			CertificateKey:   certKey,
+		}
+	}
+	return marshalDocuments(c)
+}
+
+func parseJoinCommand(cmd string) (bootstrapTokenDiscovery, error) {
+	var d bootstrapTokenDiscovery
+	fields := strings.Fields(cmd)
+	for i := 0; i < len(fields); i++ {
+		switch {
+		case fields[i] == "join" && i+1 < len(fields):
+			i++
+			d.APIServerEndpoint = fields[i]
+		case fields[i] == "--token" && i+1 < len(fields):
+			i++
+			d.Token = fields[i]
+		case fields[i] == "--discovery-token-ca-cert-hash" && i+1 < len(fields):
+			i++
+			d.CACertHashes = append(d.CACertHashes, fields[i])
+		}
+	}
+	if d.APIServerEndpoint == "" || d.Token == "" || len(d.CACertHashes) == 0 {
+		return d, errors.New("unexpected output of kubeadm token create --print-join-command")
+	}
+	return d, nil
+}
+
+// maskKubeadmOutput hides the bootstrap token and the certificate key in the
+// output of kubeadm init, which ends up in the job events.
+func maskKubeadmOutput(output string) string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if i > 0 && strings.Contains(lines[i-1], "Using certificate key") {
+			lines[i] = "****"
+			continue
+		}
+		line = secretFlagPattern.ReplaceAllString(line, "$1$2****")
+		lines[i] = bootstrapTokenPattern.ReplaceAllString(line, "****")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// criSocketURL adds the unix scheme kubeadm expects to a socket path.
+func criSocketURL(socket string) string {
+	if socket == "" || strings.Contains(socket, "://") {
+		return socket
+	}
+	return "unix://" + socket
+}
+
+func marshalDocuments(docs ...any) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, doc := range docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeKubeadmConfig uploads the init configuration to the master and
+// returns the directory it was written to.
+func (e *Engine) writeKubeadmConfig() (string, error) {
+	data, err := e.KubeadmConfig()
+	if err != nil {
+		return "", err
+	}
+	if err := e.master.WriteFile(filepath.Join(e.kubeadmResource(), kubeadmConfigFile), data, 0o600); err != nil {
+		return "", err
+	}
+	return e.kubeadmDir(), nil
+}
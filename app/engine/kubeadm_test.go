@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+const kubeadmInitOutput = `[upload-certs] Using certificate key:
+3c4f8b2e9d1a7f6e5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a
+[bootstrap-token] Using token: abcdef.0123456789abcdef
+You can now join any number of the control-plane node running the following command on each as root:
+
+  kubeadm join 192.168.56.151:6443 --token abcdef.0123456789abcdef \
+	--discovery-token-ca-cert-hash sha256:1a2b3c \
+	--control-plane --certificate-key 3c4f8b2e9d1a7f6e5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a
+`
+
+func TestMaskKubeadmOutput(t *testing.T) {
+	got := maskKubeadmOutput(kubeadmInitOutput)
+	for _, secret := range []string{"abcdef.0123456789abcdef", "3c4f8b2e9d1a7f6e"} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("output still contains %s:\n%s", secret, got)
+		}
+	}
+	for _, keep := range []string{"--token ****", "--certificate-key ****", "sha256:1a2b3c", "kubeadm join 192.168.56.151:6443"} {
+		if !strings.Contains(got, keep) {
+			t.Fatalf("output lost %q:\n%s", keep, got)
+		}
+	}
+}
+
+func TestCheckKubeadmCIDRs(t *testing.T) {
+	tests := []struct {
+		name        string
+		plugin      string
+		podCIDR     string
+		serviceCIDR string
+		wantErr     bool
+	}{
+		{name: "calico default", plugin: "calico"},
+		{name: "cilium default", plugin: "cilium"},
+		{name: "pod contains default service", plugin: "cilium", podCIDR: "10.0.0.0/8", wantErr: true},
+		{name: "pod contains service", plugin: "flannel", serviceCIDR: "10.244.16.0/20", wantErr: true},
+		{name: "service contains pod", plugin: "flannel", podCIDR: "10.100.0.0/16", wantErr: true},
+		{name: "separate", plugin: "cilium", podCIDR: "10.0.0.0/8", serviceCIDR: "172.20.0.0/16"},
+		{name: "invalid service", plugin: "calico", serviceCIDR: "10.96.0.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(CNI(tt.plugin, tt.podCIDR), Kubeadm("", tt.serviceCIDR, "", nil, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.checkKubeadm(); (err != nil) != tt.wantErr {
+				t.Fatalf("checkKubeadm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKubeadmConfig(t *testing.T) {
+	e := newTestEngine(t, []Option{
+		Vip("10.0.0.100"), Registry("registry.example.com"), KubernetesVersion("v1.28.2"), Runtime("containerd"), CNI("flannel", ""),
+		Kubeadm("", "10.96.0.0/12", "cluster.local", []string{"api.example.com", "10.0.0.100"}, map[string]string{"max-pods": "200"}),
+	}, "10.0.0.1:etcd,controlplane", "10.0.0.2:etcd,controlplane", "10.0.0.11:worker")
+	got, err := e.KubeadmConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: kubeadm.k8s.io/v1beta3
+kind: InitConfiguration
+localAPIEndpoint:
+  advertiseAddress: 10.0.0.1
+  bindPort: 6443
+nodeRegistration:
+  name: node1
+  criSocket: unix:///run/containerd/containerd.sock
+  kubeletExtraArgs:
+    max-pods: "200"
+---
+apiVersion: kubeadm.k8s.io/v1beta3
+kind: ClusterConfiguration
+kubernetesVersion: v1.28.2
+controlPlaneEndpoint: 10.0.0.100:8443
+imageRepository: registry.example.com/google_containers
+networking:
+  podSubnet: 10.244.0.0/16
+  serviceSubnet: 10.96.0.0/12
+  dnsDomain: cluster.local
+apiServer:
+  certSANs:
+    - 10.0.0.100
+    - 10.0.0.1
+    - node1
+    - 10.0.0.2
+    - node2
+    - api.example.com
+`
+	if string(got) != want {
+		t.Fatalf("KubeadmConfig() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestJoinConfig(t *testing.T) {
+	e := newTestEngine(t, nil, "10.0.0.1:etcd,controlplane", "10.0.0.2:etcd,controlplane", "10.0.0.11:worker")
+	join := "kubeadm join 10.0.0.100:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1a2b \n"
+	tests := []struct {
+		name string
+		node int
+		want []string
+		not  []string
+	}{
+		{name: "control plane", node: 1, want: []string{"apiServerEndpoint: 10.0.0.100:6443", "token: abcdef.0123456789abcdef", "- sha256:1a2b", "name: node2", "advertiseAddress: 10.0.0.2", "certificateKey: key"}},
+		{name: "worker", node: 2, want: []string{"name: node3"}, not: []string{"controlPlane", "certificateKey"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := e.joinConfig(e.nodes[tt.node], join, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(out), s) {
+					t.Fatalf("join config lacks %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.not {
+				if strings.Contains(string(out), s) {
+					t.Fatalf("join config has %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+	if _, err := e.joinConfig(e.nodes[2], "kubeadm join 10.0.0.100:6443", ""); err == nil {
+		t.Fatal("joinConfig() without token error = nil")
+	}
+}
+
+func TestParseCertKey(t *testing.T) {
+	key := "3c4f8b2e9d1a7f6e5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a"
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{name: "init output", output: kubeadmInitOutput, want: key},
+		{name: "no key", output: "[bootstrap-token] Using token: abcdef.0123456789abcdef\n", want: ""},
+		{name: "key missing after header", output: "[upload-certs] Using certificate key:\n", want: ""},
+		{name: "not hex", output: "[upload-certs] Using certificate key:\n" + strings.ToUpper(key) + "\n", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCertKey(tt.output); got != tt.want {
+				t.Fatalf("parseCertKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestControlPlaneEndpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "haproxy", opts: []Option{Vip("10.0.0.100")}, want: "10.0.0.100:8443"},
+		{name: "haproxy port", opts: []Option{Vip("10.0.0.100"), LoadBalancer("haproxy", "", 16443)}, want: "10.0.0.100:16443"},
+		{name: "kube-vip", opts: []Option{Vip("10.0.0.100"), LoadBalancer("kube-vip", "", 0)}, want: "10.0.0.100"},
+		{name: "external", opts: []Option{Vip("10.0.0.100"), LoadBalancer("external", "lb.example.com", 0)}, want: "lb.example.com"},
+		{name: "external port", opts: []Option{LoadBalancer("external", "lb.example.com", 443)}, want: "lb.example.com:443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, tt.opts, "10.0.0.1:etcd,controlplane")
+			if got := e.controlPlaneEndpoint(); got != tt.want {
+				t.Fatalf("controlPlaneEndpoint() = %q, want %q", got, tt.want)
+			}
+			out, err := e.KubeadmConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(out), "\ncontrolPlaneEndpoint: "+tt.want+"\n") {
+				t.Fatalf("KubeadmConfig() lacks controlPlaneEndpoint %s:\n%s", tt.want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var csrNameInvalid = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// kubeconfig keeps the entries as maps so merging into an existing file
+// does not drop fields this tool does not know about.
+type kubeconfig struct {
+	APIVersion     string         `yaml:"apiVersion"`
+	Kind           string         `yaml:"kind"`
+	Clusters       []namedEntry   `yaml:"clusters"`
+	Contexts       []namedEntry   `yaml:"contexts"`
+	CurrentContext string         `yaml:"current-context"`
+	Users          []namedEntry   `yaml:"users"`
+	Preferences    map[string]any `yaml:"preferences,omitempty"`
+}
+
+type namedEntry struct {
+	Name    string         `yaml:"name"`
+	Cluster map[string]any `yaml:"cluster,omitempty"`
+	Context map[string]any `yaml:"context,omitempty"`
+	User    map[string]any `yaml:"user,omitempty"`
+}
+
+func upsertEntry(entries []namedEntry, entry namedEntry) []namedEntry {
+	for i := range entries {
+		if entries[i].Name == entry.Name {
+			entries[i] = entry
+			return entries
+		}
+	}
+	return append(entries, entry)
+}
+
+// apiServerURL is the control plane endpoint as a URL.
+func (e *Engine) apiServerURL() string {
+	endpoint := e.controlPlaneEndpoint()
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		endpoint = net.JoinHostPort(endpoint, strconv.Itoa(apiServerPort))
+	}
+	return "https://" + endpoint
+}
+
+// readAdminKubeconfig reads the admin kubeconfig configureKubectl put on the
+// master and returns it with its cluster entry.
+func (e *Engine) readAdminKubeconfig() (*kubeconfig, map[string]any, error) {
+	data, err := e.master.ReadFile("~/.kube/config")
+	if err != nil {
+		return nil, nil, err
+	}
+	var c kubeconfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, nil, fmt.Errorf("parse admin kubeconfig: %w", err)
+	}
+	if len(c.Clusters) == 0 || len(c.Users) == 0 {
+		return nil, nil, errors.New("admin kubeconfig has no cluster or user")
+	}
+	cluster := c.Clusters[0].Cluster
+	if e.controlPlaneEndpoint() != "" {
+		cluster["server"] = e.apiServerURL()
+	}
+	return &c, cluster, nil
+}
+
+func newKubeconfig(name, user string, cluster, credentials map[string]any) *kubeconfig {
+	return &kubeconfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []namedEntry{{Name: name, Cluster: cluster}},
+		Contexts:       []namedEntry{{Name: user + "@" + name, Context: map[string]any{"cluster": name, "user": user}}},
+		CurrentContext: user + "@" + name,
+		Users:          []namedEntry{{Name: user, User: credentials}},
+	}
+}
+
+// AdminKubeconfig downloads the admin kubeconfig of the master with the
+// server pointed at the control plane endpoint and the cluster, user and
+// context renamed after name.
+func (e *Engine) AdminKubeconfig(name string) ([]byte, error) {
+	if err := e.connectMaster(); err != nil {
+		return nil, err
+	}
+	defer e.closeAll()
+
+	c, cluster, err := e.readAdminKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	return marshalDocuments(newKubeconfig(name, name+"-admin", cluster, c.Users[0].User))
+}
+
+// UserKubeconfig mints a client certificate for user in groups through the
+// certificates API, optionally binds user to clusterRole and returns a
+// kubeconfig for it.
+func (e *Engine) UserKubeconfig(name, user string, groups []string, clusterRole string, expiration time.Duration) ([]byte, error) {
+	if user == "" {
+		return nil, errors.New("user is required")
+	}
+	if err := e.connectMaster(); err != nil {
+		return nil, err
+	}
+	defer e.closeAll()
+
+	_, cluster, err := e.readAdminKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: user, Organization: groups},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := e.signClientCert(user, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}), expiration)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if clusterRole != "" {
+		binding := "k8s-tool:" + user + ":" + clusterRole
+		if _, err := e.master.Run("", fmt.Sprintf(
+			"kubectl create clusterrolebinding %s --clusterrole=%s --user=%s --dry-run=client -o yaml | kubectl apply -f -",
+			shellQuote(binding), shellQuote(clusterRole), shellQuote(user))); err != nil {
+			return nil, fmt.Errorf("bind %s to %s: %w", user, clusterRole, err)
+		}
+	}
+
+	return marshalDocuments(newKubeconfig(name, user, cluster, map[string]any{
+		"client-certificate-data": base64.StdEncoding.EncodeToString(cert),
+		"client-key-data":         base64.StdEncoding.EncodeToString(keyPEM),
+	}))
+}
+
+// signClientCert has the API server sign csr with a CertificateSigningRequest
+// that is approved and removed again.
+func (e *Engine) signClientCert(user string, csr []byte, expiration time.Duration) ([]byte, error) {
+	name := fmt.Sprintf("k8s-tool-%s-%d", csrNameInvalid.ReplaceAllString(strings.ToLower(user), "-"), time.Now().Unix())
+	manifest, err := marshalDocuments(map[string]any{
+		"apiVersion": "certificates.k8s.io/v1",
+		"kind":       "CertificateSigningRequest",
+		"metadata":   map[string]any{"name": name},
+		"spec": map[string]any{
+			"request":           base64.StdEncoding.EncodeToString(csr),
+			"signerName":        "kubernetes.io/kube-apiserver-client",
+			"expirationSeconds": int(expiration.Seconds()),
+			"usages":            []string{"client auth"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	file := "~/" + name + ".yaml"
+	if err := e.master.WriteFile(file, manifest, 0o600); err != nil {
+		return nil, err
+	}
+	defer e.master.Run("", fmt.Sprintf("rm -f %s.yaml; kubectl delete csr %s --ignore-not-found", name, name))
+
+	if _, err := e.master.Run("",
+		fmt.Sprintf("kubectl apply -f %s.yaml", name),
+		fmt.Sprintf("kubectl certificate approve %s", name),
+	); err != nil {
+		return nil, fmt.Errorf("approve certificate for %s: %w", user, err)
+	}
+	for i := 0; i < 30; i++ {
+		out, err := e.master.Run("", fmt.Sprintf("kubectl get csr %s -o jsonpath='{.status.certificate}'", name))
+		if err != nil {
+			return nil, err
+		}
+		if s := strings.TrimSpace(string(out)); s != "" {
+			return base64.StdEncoding.DecodeString(s)
+		}
+		time.Sleep(time.Second)
+	}
+	return nil, fmt.Errorf("certificate for %s was not issued", user)
+}
+
+func (e *Engine) connectMaster() error {
+	if e.master == nil {
+		return errors.New("cluster doesn't have control plane node")
+	}
+	return e.master.Connect()
+}
+
+// MergeKubeconfig merges the clusters, users and contexts of data into the
+// kubeconfig file at path, replacing entries of the same name. The current
+// context is only set when the file has none.
+func MergeKubeconfig(path string, data []byte) error {
+	var in kubeconfig
+	if err := yaml.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	out := kubeconfig{APIVersion: "v1", Kind: "Config"}
+	existing, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(existing, &out); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	for _, c := range in.Clusters {
+		out.Clusters = upsertEntry(out.Clusters, c)
+	}
+	for _, u := range in.Users {
+		out.Users = upsertEntry(out.Users, u)
+	}
+	for _, c := range in.Contexts {
+		out.Contexts = upsertEntry(out.Contexts, c)
+	}
+	if out.CurrentContext == "" {
+		out.CurrentContext = in.CurrentContext
+	}
+	merged, err := marshalDocuments(&out)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, merged, 0o600)
+}
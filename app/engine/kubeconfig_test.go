@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMergeKubeconfig(t *testing.T) {
+	in, err := marshalDocuments(newKubeconfig("prod", "prod-admin",
+		map[string]any{"server": "https://10.0.0.100:6443"},
+		map[string]any{"token": "new"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod := namedEntry{Name: "prod", Cluster: map[string]any{"server": "https://10.0.0.100:6443"}}
+	prodUser := namedEntry{Name: "prod-admin", User: map[string]any{"token": "new"}}
+	prodContext := namedEntry{Name: "prod-admin@prod", Context: map[string]any{"cluster": "prod", "user": "prod-admin"}}
+	dev := namedEntry{Name: "dev", Cluster: map[string]any{"server": "https://dev:6443", "insecure-skip-tls-verify": true}}
+	devUser := namedEntry{Name: "dev-admin", User: map[string]any{"token": "dev"}}
+	devContext := namedEntry{Name: "dev-admin@dev", Context: map[string]any{"cluster": "dev", "user": "dev-admin", "namespace": "apps"}}
+
+	tests := []struct {
+		name     string
+		existing *kubeconfig
+		want     kubeconfig
+	}{
+		{
+			name: "no file",
+			want: kubeconfig{
+				APIVersion: "v1", Kind: "Config",
+				Clusters: []namedEntry{prod}, Contexts: []namedEntry{prodContext}, Users: []namedEntry{prodUser},
+				CurrentContext: "prod-admin@prod",
+			},
+		},
+		{
+			name: "other cluster keeps current context",
+			existing: &kubeconfig{
+				APIVersion: "v1", Kind: "Config",
+				Clusters: []namedEntry{dev}, Contexts: []namedEntry{devContext}, Users: []namedEntry{devUser},
+				CurrentContext: "dev-admin@dev", Preferences: map[string]any{"colors": true},
+			},
+			want: kubeconfig{
+				APIVersion: "v1", Kind: "Config",
+				Clusters: []namedEntry{dev, prod}, Contexts: []namedEntry{devContext, prodContext}, Users: []namedEntry{devUser, prodUser},
+				CurrentContext: "dev-admin@dev", Preferences: map[string]any{"colors": true},
+			},
+		},
+		{
+			name: "same cluster is replaced",
+			existing: &kubeconfig{
+				APIVersion: "v1", Kind: "Config",
+				Clusters: []namedEntry{{Name: "prod", Cluster: map[string]any{"server": "https://old:6443"}}, dev},
+				Users:    []namedEntry{{Name: "prod-admin", User: map[string]any{"token": "old"}}},
+			},
+			want: kubeconfig{
+				APIVersion: "v1", Kind: "Config",
+				Clusters: []namedEntry{prod, dev}, Contexts: []namedEntry{prodContext}, Users: []namedEntry{prodUser},
+				CurrentContext: "prod-admin@prod",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".kube", "config")
+			if tt.existing != nil {
+				data, err := marshalDocuments(tt.existing)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := MergeKubeconfig(path, in); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got kubeconfig
+			if err := yaml.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("MergeKubeconfig() =\n%s\nwant %+v", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeKubeconfigErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("clusters: {"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "invalid input", data: "clusters: ["},
+		{name: "invalid existing file", data: "apiVersion: v1\nkind: Config\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := MergeKubeconfig(path, []byte(tt.data)); err == nil {
+				t.Fatal("MergeKubeconfig() error = nil")
+			}
+		})
+	}
+}
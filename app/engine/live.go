@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const nodeRoleLabel = "node-role.kubernetes.io/"
+
+// liveNode is a node as the API server reports it.
+type liveNode struct {
+	Name           string
+	InternalIP     string
+	Ready          bool
+	Roles          []string
+	KubeletVersion string
+	Labels         map[string]string
+	Taints         []string
+}
+
+// hasTaint reports whether the node has a taint with key.
+func (n liveNode) hasTaint(key string) bool {
+	for _, t := range n.Taints {
+		if k, _, _ := strings.Cut(t, ":"); k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// liveNodes lists the nodes of the cluster through kubectl on the master.
+func (e *Engine) liveNodes() ([]liveNode, error) {
+	out, err := e.master.Run("", "kubectl get nodes -o json")
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name   string            `json:"name"`
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+			Spec struct {
+				Taints []struct {
+					Key    string `json:"key"`
+					Effect string `json:"effect"`
+				} `json:"taints"`
+			} `json:"spec"`
+			Status struct {
+				Addresses []struct {
+					Type    string `json:"type"`
+					Address string `json:"address"`
+				} `json:"addresses"`
+				Conditions []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+				} `json:"conditions"`
+				NodeInfo struct {
+					KubeletVersion string `json:"kubeletVersion"`
+				} `json:"nodeInfo"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("parse kubectl get nodes: %w", err)
+	}
+	nodes := make([]liveNode, 0, len(list.Items))
+	for _, item := range list.Items {
+		n := liveNode{
+			Name:           item.Metadata.Name,
+			Labels:         item.Metadata.Labels,
+			KubeletVersion: item.Status.NodeInfo.KubeletVersion,
+		}
+		for _, a := range item.Status.Addresses {
+			if a.Type == "InternalIP" {
+				n.InternalIP = a.Address
+				break
+			}
+		}
+		for _, c := range item.Status.Conditions {
+			if c.Type == "Ready" {
+				n.Ready = c.Status == "True"
+			}
+		}
+		for _, t := range item.Spec.Taints {
+			n.Taints = append(n.Taints, t.Key+":"+t.Effect)
+		}
+		for label := range n.Labels {
+			if role, ok := strings.CutPrefix(label, nodeRoleLabel); ok && role != "" {
+				n.Roles = append(n.Roles, role)
+			}
+		}
+		sort.Strings(n.Roles)
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"k8s-tool/app/node"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	lbHaproxy  = "haproxy"
+	lbKubeVip  = "kube-vip"
+	lbExternal = "external"
+
+	// defaultHaproxyPort is the haproxy frontend on the etcd nodes, which
+	// cannot share 6443 with the API server of a control plane.
+	defaultHaproxyPort = 8443
+)
+
+type kubeVipConfig struct {
+	mode     string
+	iface    string
+	bgpAS    uint32
+	bgpPeers string
+}
+
+func validLoadBalancerMode(mode string) (string, error) {
+	switch m := strings.ToLower(mode); m {
+	case "":
+		return lbHaproxy, nil
+	case lbHaproxy, lbKubeVip, lbExternal:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid load balancer mode %q: valid modes are %s, %s, %s", mode, lbHaproxy, lbKubeVip, lbExternal)
+	}
+}
+
+func (e *Engine) checkLoadBalancer() error {
+	switch e.lb.mode {
+	case lbExternal:
+		if e.lb.address == "" {
+			return errors.New("load balancer address is required in external mode")
+		}
+	case lbKubeVip:
+		if e.vip == "" {
+			return errors.New("vip is required in kube-vip mode")
+		}
+		if e.lb.port != 0 {
+			return fmt.Errorf("load balancer port is not used in kube-vip mode, the vip serves the API server port %d", apiServerPort)
+		}
+		if e.lb.kubeVip.mode == "bgp" && (e.lb.kubeVip.bgpAS == 0 || e.lb.kubeVip.bgpPeers == "") {
+			return errors.New("kube-vip bgp mode needs bgpAS and bgpPeers")
+		}
+	}
+	return nil
+}
+
+// controlPlaneEndpoint is the address kubeadm and the nodes use to reach the
+// API server: the vip with the haproxy frontend port, the vip alone for
+// kube-vip, or the external load balancer.
+func (e *Engine) controlPlaneEndpoint() string {
+	host, port := e.vip, e.lb.port
+	switch e.lb.mode {
+	case lbHaproxy:
+		if port == 0 {
+			port = defaultHaproxyPort
+		}
+	case lbExternal:
+		host = e.lb.address
+	}
+	if host == "" || port == 0 {
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+func (e *Engine) installLoadBalancer() error {
+	if e.lb.mode != lbHaproxy {
+		e.log.Infof("Load balancer mode is %s, skip haproxy", e.lb.mode)
+		return nil
+	}
+	return e.installHa()
+}
+
+func (e *Engine) installVIP() error {
+	switch e.lb.mode {
+	case lbHaproxy:
+		return e.installKeepalived()
+	case lbKubeVip:
+		// 其他 control-plane 在 join 之后再安装，kubeadm join 要求 manifests 目录为空
+		return e.installKubeVip(e.master)
+	default:
+		e.log.Infof("Load balancer mode is %s, skip vip", e.lb.mode)
+		return nil
+	}
+}
+
+// installKubeVip puts the kube-vip static pod on the control-plane node n.
+func (e *Engine) installKubeVip(n node.Node) error {
+	kv := e.lb.kubeVip
+	mode := kv.mode
+	if mode == "" {
+		mode = "arp"
+	}
+	if err := n.Install("kube-vip", e.vip, kv.iface, mode,
+		strconv.FormatUint(uint64(kv.bgpAS), 10), kv.bgpPeers, n.GetAddress()); err != nil {
+		return fmt.Errorf("%s: install kube-vip: %w", n.GetHostname(), err)
+	}
+	e.installed(lbKubeVip)
+	return nil
+}
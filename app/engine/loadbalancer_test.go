@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckLoadBalancer(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr string
+	}{
+		{name: "haproxy", opts: []Option{Vip("10.0.0.100")}},
+		{name: "haproxy port", opts: []Option{Vip("10.0.0.100"), LoadBalancer("haproxy", "", 16443)}},
+		{name: "haproxy without vip", opts: []Option{LoadBalancer("haproxy", "", 0)}},
+		{name: "external", opts: []Option{LoadBalancer("external", "lb.example.com", 0)}},
+		{name: "external port", opts: []Option{LoadBalancer("external", "lb.example.com", 443)}},
+		{name: "external without address", opts: []Option{Vip("10.0.0.100"), LoadBalancer("external", "", 443)}, wantErr: "load balancer address is required in external mode"},
+		{name: "kube-vip", opts: []Option{Vip("10.0.0.100"), LoadBalancer("kube-vip", "", 0)}},
+		{name: "kube-vip port", opts: []Option{Vip("10.0.0.100"), LoadBalancer("kube-vip", "", 8443)}, wantErr: "load balancer port is not used in kube-vip mode"},
+		{name: "kube-vip without vip", opts: []Option{LoadBalancer("kube-vip", "", 0)}, wantErr: "vip is required in kube-vip mode"},
+		{name: "kube-vip bgp", opts: []Option{Vip("10.0.0.100"), LoadBalancer("kube-vip", "", 0), KubeVip("bgp", "eth0", 65000, "10.0.0.254:65000")}},
+		{name: "kube-vip bgp without peers", opts: []Option{Vip("10.0.0.100"), LoadBalancer("kube-vip", "", 0), KubeVip("bgp", "eth0", 65000, "")}, wantErr: "kube-vip bgp mode needs bgpAS and bgpPeers"},
+		{name: "kube-vip bgp without as", opts: []Option{Vip("10.0.0.100"), LoadBalancer("kube-vip", "", 0), KubeVip("bgp", "eth0", 0, "10.0.0.254:65000")}, wantErr: "kube-vip bgp mode needs bgpAS and bgpPeers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, tt.opts, "10.0.0.1:etcd,controlplane,worker")
+			err := e.checkLoadBalancer()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("checkLoadBalancer() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("checkLoadBalancer() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadBalancerOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     Option
+		wantErr string
+	}{
+		{name: "default mode", opt: LoadBalancer("", "", 0)},
+		{name: "mode case", opt: LoadBalancer("Kube-VIP", "", 0)},
+		{name: "unknown mode", opt: LoadBalancer("nginx", "", 0), wantErr: `invalid load balancer mode "nginx"`},
+		{name: "kube-vip arp", opt: KubeVip("ARP", "", 0, "")},
+		{name: "unknown kube-vip mode", opt: KubeVip("ospf", "", 0, ""), wantErr: `invalid kube-vip mode "ospf"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opt)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("New() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// joinReply answers the master like a cluster in which every node is
+// registered as soon as it joined.
+func joinReply(hostname, cmd string) (string, error) {
+	switch {
+	case strings.HasPrefix(cmd, "sudo kubeadm token create"):
+		return "kubeadm join 10.0.0.100:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:0123\n", nil
+	case strings.HasPrefix(cmd, "kubectl get node "):
+		return "node/x\n", nil
+	}
+	return "", nil
+}
+
+func TestInstallKubeVip(t *testing.T) {
+	specs := []string{"10.0.0.1:etcd,controlplane", "10.0.0.2:etcd,controlplane", "10.0.0.3:etcd,controlplane,worker", "10.0.0.4:worker"}
+	join := func(hostname string) string {
+		return hostname + ": sudo kubeadm join --config=kubeadm-join.yaml; rc=$?; rm -f kubeadm-join.yaml; exit $rc"
+	}
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "arp",
+			opts: []Option{Vip("10.0.0.100"), LoadBalancer("kube-vip", "", 0), KubeVip("", "eth0", 0, "")},
+			want: []string{
+				"node1: install kube-vip 10.0.0.100 eth0 arp 0  10.0.0.1",
+				join("node2"),
+				"node2: install kube-vip 10.0.0.100 eth0 arp 0  10.0.0.2",
+				join("node3"),
+				"node3: install kube-vip 10.0.0.100 eth0 arp 0  10.0.0.3",
+				join("node4"),
+			},
+		},
+		{
+			name: "bgp",
+			opts: []Option{Vip("10.0.0.100"), LoadBalancer("kube-vip", "", 0), KubeVip("bgp", "", 65000, "10.0.0.254:65000")},
+			want: []string{
+				"node1: install kube-vip 10.0.0.100  bgp 65000 10.0.0.254:65000 10.0.0.1",
+				join("node2"),
+				"node2: install kube-vip 10.0.0.100  bgp 65000 10.0.0.254:65000 10.0.0.2",
+				join("node3"),
+				"node3: install kube-vip 10.0.0.100  bgp 65000 10.0.0.254:65000 10.0.0.3",
+				join("node4"),
+			},
+		},
+		{
+			name: "external",
+			opts: []Option{LoadBalancer("external", "lb.example.com", 0)},
+			want: []string{join("node2"), join("node3"), join("node4")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, log := newFakeEngine(t, tt.opts, joinReply, specs...)
+			// the master gets kube-vip before kubeadm init, the other control
+			// planes only once they joined: join needs an empty manifests dir
+			if err := e.installVIP(); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.joinNodes("key"); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range log.entries {
+				if strings.Contains(entry, "install kube-vip") || strings.Contains(entry, "kubeadm join") {
+					got = append(got, entry)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("installs and joins =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -1,5 +1,12 @@
 package engine
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
 type Option func(e *Engine) error
 
 func Namespace(namespace string) Option {
@@ -53,3 +60,114 @@ func Registry(address string) Option {
 		return nil
 	}
 }
+
+func Logger(log logrus.FieldLogger) Option {
+	return func(e *Engine) error {
+		if log != nil {
+			e.log = log
+		}
+		return nil
+	}
+}
+
+func Runtime(name string) Option {
+	return func(e *Engine) error {
+		rt, err := lookupRuntime(name)
+		if err != nil {
+			return err
+		}
+		e.runtime = rt
+		return nil
+	}
+}
+
+func CNI(plugin, podCIDR string) Option {
+	return func(e *Engine) error {
+		p, err := lookupCNI(plugin)
+		if err != nil {
+			return err
+		}
+		if err := validateCIDR(podCIDR); err != nil {
+			return err
+		}
+		e.cni.plugin = p
+		e.cni.podCIDR = podCIDR
+		return nil
+	}
+}
+
+// KubernetesVersion pins the version to install, taken from the
+// resource/kubeadm/<version> bundle.
+func KubernetesVersion(version string) Option {
+	return func(e *Engine) error {
+		v, err := normalizeVersion(version)
+		if err != nil {
+			return err
+		}
+		e.kubeadm.version = v
+		e.kubeadm.pinned = v != ""
+		return nil
+	}
+}
+
+// UpgradeBatch sets how many workers are drained and upgraded at once.
+func UpgradeBatch(size int) Option {
+	return func(e *Engine) error {
+		if size < 1 {
+			return fmt.Errorf("invalid upgrade batch %d: must be at least 1", size)
+		}
+		e.upgrade.batch = size
+		return nil
+	}
+}
+
+// Nodes restricts the per-node steps of install, update and reset to the
+// nodes matching s. Cluster-level steps still run on the master.
+func Nodes(s Selector) Option {
+	return func(e *Engine) error {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		e.selector = s
+		return nil
+	}
+}
+
+// Kubeadm sets the values of the generated kubeadm configuration. Empty
+// values keep the kubeadm defaults.
+func Kubeadm(imageRepository, serviceCIDR, dnsDomain string, certSANs []string, kubeletExtraArgs map[string]string) Option {
+	return func(e *Engine) error {
+		e.kubeadm.imageRepository = imageRepository
+		e.kubeadm.serviceCIDR = serviceCIDR
+		e.kubeadm.dnsDomain = dnsDomain
+		e.kubeadm.certSANs = certSANs
+		e.kubeadm.kubeletExtraArgs = kubeletExtraArgs
+		return nil
+	}
+}
+
+// LoadBalancer selects how the control plane endpoint is served: haproxy
+// (with keepalived), kube-vip or an external address.
+func LoadBalancer(mode, address string, port uint16) Option {
+	return func(e *Engine) error {
+		m, err := validLoadBalancerMode(mode)
+		if err != nil {
+			return err
+		}
+		e.lb.mode = m
+		e.lb.address = address
+		e.lb.port = port
+		return nil
+	}
+}
+
+func KubeVip(mode, iface string, bgpAS uint32, bgpPeers string) Option {
+	return func(e *Engine) error {
+		mode = strings.ToLower(mode)
+		if mode != "" && mode != "arp" && mode != "bgp" {
+			return fmt.Errorf("invalid kube-vip mode %q: valid modes are arp, bgp", mode)
+		}
+		e.lb.kubeVip = kubeVipConfig{mode: mode, iface: iface, bgpAS: bgpAS, bgpPeers: bgpPeers}
+		return nil
+	}
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+)
+
+// Report summarizes what the last run left on the cluster.
+type Report struct {
+	KubernetesVersion string   `json:"kubernetesVersion,omitempty"`
+	Components        []string `json:"components,omitempty"`
+}
+
+func (e *Engine) Report() Report {
+	return Report{
+		KubernetesVersion: e.report.KubernetesVersion,
+		Components:        slices.Clone(e.report.Components),
+	}
+}
+
+func (e *Engine) installed(component string) {
+	if !slices.Contains(e.report.Components, component) {
+		e.report.Components = append(e.report.Components, component)
+	}
+}
+
+func (e *Engine) collectVersion() {
+	if !e.connected {
+		return
+	}
+	out, err := e.master.Run("", "kubeadm version -o short")
+	if err != nil {
+		e.log.Warnf("read kubernetes version: %v", err)
+		return
+	}
+	e.report.KubernetesVersion = strings.TrimSpace(string(out))
+}
@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"fmt"
+	"k8s-tool/app/node"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultRuntime = "docker"
+
+type containerRuntime struct {
+	name string
+	// resource installs the runtime, images holds its image archives
+	resource string
+	images   string
+	socket   string
+	// loadImage imports one image archive with tool, %s is the file name
+	loadImage string
+	tool      string
+}
+
+var runtimes = map[string]containerRuntime{
+	"docker": {
+		name:      "docker",
+		resource:  "docker",
+		images:    "docker/images",
+		socket:    "unix:///var/run/cri-dockerd.sock",
+		loadImage: "sudo docker load -i %s",
+	},
+	"containerd": {
+		name:      "containerd",
+		resource:  "containerd",
+		images:    "containerd/images",
+		socket:    "unix:///run/containerd/containerd.sock",
+		loadImage: "sudo ctr -n k8s.io images import %s",
+		tool:      "ctr",
+	},
+	"cri-o": {
+		name:      "cri-o",
+		resource:  "cri-o",
+		images:    "cri-o/images",
+		socket:    "unix:///var/run/crio/crio.sock",
+		loadImage: "sudo podman load -i %s",
+		tool:      "podman",
+	},
+}
+
+func lookupRuntime(name string) (containerRuntime, error) {
+	if name == "" {
+		name = defaultRuntime
+	}
+	rt, ok := runtimes[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(runtimes))
+		for n := range runtimes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return containerRuntime{}, fmt.Errorf("invalid runtime %q: valid runtimes are %s", name, strings.Join(names, ", "))
+	}
+	return rt, nil
+}
+
+func (e *Engine) installRuntime() error {
+	var eg errgroup.Group
+	for i := range e.nodes {
+		n := e.nodes[i]
+		if !n.IsNew() {
+			continue
+		}
+		eg.Go(func() error {
+			return n.Install(e.runtime.resource, e.registry.hostname)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	e.installed(e.runtime.name)
+	return nil
+}
+
+func (e *Engine) loadRuntimeImages() error {
+	var eg errgroup.Group
+	for i := range e.nodes {
+		n := e.nodes[i]
+		if !n.IsNew() {
+			continue
+		}
+		eg.Go(func() error {
+			return e.loadImages(n, e.runtime.images)
+		})
+	}
+	return eg.Wait()
+}
+
+// loadImages loads the image archives of the resource dir into the container
+// runtime of n. Docker bundles keep their own install.sh; for the other
+// runtimes the archives are imported directly.
+func (e *Engine) loadImages(n node.Node, name string) error {
+	if e.runtime.name == "docker" {
+		return n.Install(name)
+	}
+	if name == e.runtime.images {
+		// 运行时没有单独的镜像包时复用 docker 的镜像归档
+		if _, err := os.Stat(filepath.Join("resource", name)); err != nil {
+			name = runtimes["docker"].images
+		}
+	}
+	if err := e.checkImageTool(n); err != nil {
+		return err
+	}
+	dir, err := n.UploadResource(name)
+	if err != nil {
+		return err
+	}
+	return e.importImages(n, dir)
+}
+
+// checkImageTool fails before any upload when the command importing the
+// image archives is missing on n. cri-o does not ship podman, so
+// resource/cri-o/install.sh has to install it.
+func (e *Engine) checkImageTool(n node.Node) error {
+	if _, err := n.Run("", "command -v "+e.runtime.tool); err != nil {
+		return fmt.Errorf("%s: %s is needed to load the %s images but is not installed, install it with resource/%s/install.sh",
+			n.GetHostname(), e.runtime.tool, e.runtime.name, e.runtime.resource)
+	}
+	return nil
+}
+
+// importImages loads the image archives in dir, already on n, into the
+// container runtime.
+func (e *Engine) importImages(n node.Node, dir string) error {
+	load := fmt.Sprintf(e.runtime.loadImage, `"$f"`)
+	out, err := n.Run(dir, fmt.Sprintf(
+		`for f in *.tar *.tar.gz *.tgz; do if [ -e "$f" ]; then echo "loading $f"; %s || exit 1; fi; done`, load))
+	if len(out) > 0 {
+		e.log.Info(string(out))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: load images from %s: %w", n.GetHostname(), dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// chdirResources runs the rest of the test in a temporary directory holding
+// the given resource dirs.
+func chdirResources(t *testing.T, dirs ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(dir, "resource", d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestLookupRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{name: "", want: "docker"},
+		{name: "containerd", want: "containerd"},
+		{name: "CRI-O", want: "cri-o"},
+		{name: "rkt", wantErr: `invalid runtime "rkt": valid runtimes are containerd, cri-o, docker`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt, err := lookupRuntime(tt.name)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("lookupRuntime() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rt.name != tt.want {
+				t.Fatalf("lookupRuntime() = %s, want %s", rt.name, tt.want)
+			}
+		})
+	}
+}
+
+func TestCRISocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime string
+		socket  string
+		want    string
+		wantLog string
+	}{
+		{name: "docker", runtime: "docker", want: "unix:///var/run/cri-dockerd.sock", wantLog: "cri-socket is empty, using the docker runtime socket: unix:///var/run/cri-dockerd.sock"},
+		{name: "default", want: "unix:///var/run/cri-dockerd.sock", wantLog: "cri-socket is empty, using the docker runtime socket: unix:///var/run/cri-dockerd.sock"},
+		{name: "containerd", runtime: "containerd", socket: " ", want: "unix:///run/containerd/containerd.sock", wantLog: "cri-socket is empty, using the containerd runtime socket: unix:///run/containerd/containerd.sock"},
+		{name: "cri-o", runtime: "cri-o", want: "unix:///var/run/crio/crio.sock", wantLog: "cri-socket is empty, using the cri-o runtime socket: unix:///var/run/crio/crio.sock"},
+		{name: "set", runtime: "docker", socket: "unix:///var/run/docker.sock", want: "unix:///var/run/docker.sock", wantLog: "Using CRI socket: unix:///var/run/docker.sock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			e, err := New(Logger(logger), Runtime(tt.runtime), CRISocket(tt.socket))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.CRISocket != tt.want {
+				t.Fatalf("CRISocket = %q, want %q", e.CRISocket, tt.want)
+			}
+			e.logCRISocket()
+			if got := hook.LastEntry().Message; got != tt.wantLog {
+				t.Fatalf("logged %q, want %q", got, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestLoadImages(t *testing.T) {
+	load := func(cmd string) string {
+		return `node1: for f in *.tar *.tar.gz *.tgz; do if [ -e "$f" ]; then echo "loading $f"; ` + cmd + ` || exit 1; fi; done`
+	}
+	tests := []struct {
+		name      string
+		runtime   string
+		resources []string
+		images    string
+		missing   string
+		want      []string
+		wantErr   string
+	}{
+		{
+			name:    "docker installs its bundle",
+			runtime: "docker",
+			images:  "docker/images",
+			want:    []string{"node1: install docker/images"},
+		},
+		{
+			name:      "runtime images",
+			runtime:   "containerd",
+			resources: []string{"containerd/images", "docker/images"},
+			images:    "containerd/images",
+			want: []string{
+				"node1: command -v ctr",
+				"node1: upload containerd/images",
+				load(`sudo ctr -n k8s.io images import "$f"`),
+			},
+		},
+		{
+			name:      "docker images reused",
+			runtime:   "cri-o",
+			resources: []string{"docker/images"},
+			images:    "cri-o/images",
+			want: []string{
+				"node1: command -v podman",
+				"node1: upload docker/images",
+				load(`sudo podman load -i "$f"`),
+			},
+		},
+		{
+			name:    "no fallback for other images",
+			runtime: "containerd",
+			images:  "app/images",
+			want: []string{
+				"node1: command -v ctr",
+				"node1: upload app/images",
+				load(`sudo ctr -n k8s.io images import "$f"`),
+			},
+		},
+		{
+			name:    "podman missing",
+			runtime: "cri-o",
+			images:  "cri-o/images",
+			missing: "podman",
+			want:    []string{"node1: command -v podman"},
+			wantErr: "node1: podman is needed to load the cri-o images but is not installed, install it with resource/cri-o/install.sh",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirResources(t, tt.resources...)
+			reply := func(hostname, cmd string) (string, error) {
+				if tt.missing != "" && cmd == "command -v "+tt.missing {
+					return "", errors.New("exit status 1")
+				}
+				return "", nil
+			}
+			e, log := newFakeEngine(t, []Option{Runtime(tt.runtime)}, reply, "10.0.0.1:etcd,controlplane,worker")
+			err := e.loadImages(e.nodes[0], tt.images)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("loadImages() error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(log.entries, tt.want) {
+				t.Fatalf("loadImages() ran\n%s\nwant\n%s", strings.Join(log.entries, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"k8s-tool/app/node"
+	"net"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Selector picks nodes of the config. A node is selected when it matches
+// every non-empty field, and a field matches when any of its values does.
+type Selector struct {
+	Roles     []string
+	Hostnames []string // globs as in path.Match
+	Addresses []string
+	Networks  []*net.IPNet        // matched together with Addresses
+	Labels    map[string][]string // config node labels, keys lowercase
+}
+
+// ParseSelector parses terms like role=worker, hostname=worker-*,
+// address=10.0.0.5, 10.0.0.0/24 or zone=a. A term without "=" is an address
+// or CIDR, any key other than role, hostname and address is a label.
+func ParseSelector(terms []string) (Selector, error) {
+	var s Selector
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(term, "=")
+		if !ok {
+			key, value = "address", term
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if key == "" || value == "" {
+			return Selector{}, fmt.Errorf("invalid selector %q", term)
+		}
+		switch key {
+		case "role":
+			s.Roles = append(s.Roles, value)
+		case "hostname":
+			s.Hostnames = append(s.Hostnames, value)
+		case "address":
+			if strings.Contains(value, "/") {
+				_, network, err := net.ParseCIDR(value)
+				if err != nil {
+					return Selector{}, fmt.Errorf("invalid selector %q: %w", term, err)
+				}
+				s.Networks = append(s.Networks, network)
+			} else {
+				s.Addresses = append(s.Addresses, value)
+			}
+		default:
+			if s.Labels == nil {
+				s.Labels = map[string][]string{}
+			}
+			s.Labels[key] = append(s.Labels[key], value)
+		}
+	}
+	return s, s.validate()
+}
+
+// Empty reports whether s selects every node.
+func (s Selector) Empty() bool {
+	return len(s.Roles) == 0 && len(s.Hostnames) == 0 && len(s.Addresses) == 0 &&
+		len(s.Networks) == 0 && len(s.Labels) == 0
+}
+
+func (s Selector) validate() error {
+	for _, r := range s.Roles {
+		switch strings.ToLower(r) {
+		case "etcd", "controlplane", "worker":
+		default:
+			return fmt.Errorf("invalid role: %s", r)
+		}
+	}
+	for _, h := range s.Hostnames {
+		if _, err := path.Match(h, ""); err != nil {
+			return fmt.Errorf("invalid hostname pattern %q: %w", h, err)
+		}
+	}
+	return nil
+}
+
+// Match reports whether n is selected.
+func (s Selector) Match(n node.Node) bool {
+	if len(s.Roles) > 0 && !slices.ContainsFunc(s.Roles, func(r string) bool {
+		return slices.Contains(n.GetRole(), strings.ToLower(r))
+	}) {
+		return false
+	}
+	if len(s.Hostnames) > 0 && !slices.ContainsFunc(s.Hostnames, func(h string) bool {
+		ok, _ := path.Match(h, n.GetHostname())
+		return ok
+	}) {
+		return false
+	}
+	if len(s.Addresses) > 0 || len(s.Networks) > 0 {
+		ip := net.ParseIP(n.GetAddress())
+		if !slices.Contains(s.Addresses, n.GetAddress()) && !slices.ContainsFunc(s.Networks, func(network *net.IPNet) bool {
+			return ip != nil && network.Contains(ip)
+		}) {
+			return false
+		}
+	}
+	for key, values := range s.Labels {
+		value, ok := n.GetLabels()[key]
+		if !ok || !slices.Contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the nodes matching s in config order.
+func (e *Engine) Select(s Selector) ([]node.Node, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	var nodes []node.Node
+	for _, n := range e.nodes {
+		if s.Match(n) {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no node matches the selector")
+	}
+	return nodes, nil
+}
+
+// targeted reports whether the per-node steps of install, update and reset
+// run on n.
+func (e *Engine) targeted(n node.Node) bool {
+	return e.selector.Empty() || e.selector.Match(n)
+}
+
+// nodeName is the hostname of n, or its address before it has one.
+func nodeName(n node.Node) string {
+	if n.GetHostname() != "" {
+		return n.GetHostname()
+	}
+	return n.GetAddress()
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"k8s-tool/app/node"
+	"strings"
+	"testing"
+)
+
+func testNode(t *testing.T, addr, hostname, roles string, labels map[string]string) node.Node {
+	t.Helper()
+	n, err := node.New(node.Address(addr), node.Role(strings.Split(roles, ",")), node.Labels(labels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.SetHostname(hostname)
+	return n
+}
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		terms   []string
+		wantErr bool
+	}{
+		{name: "empty", terms: []string{"", " "}},
+		{name: "all keys", terms: []string{"role=worker", "hostname=w-*", "address=10.0.0.1", "10.0.0.0/24", "Zone=a"}},
+		{name: "unknown role", terms: []string{"role=master"}, wantErr: true},
+		{name: "bad glob", terms: []string{"hostname=w-["}, wantErr: true},
+		{name: "bad cidr", terms: []string{"10.0.0.0/33"}, wantErr: true},
+		{name: "empty value", terms: []string{"zone="}, wantErr: true},
+		{name: "empty key", terms: []string{"=a"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSelector(tt.terms); (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSelector(%q) error = %v, wantErr %v", tt.terms, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	nodes := []node.Node{
+		testNode(t, "10.0.0.1", "master-1", "etcd,controlplane", map[string]string{"zone": "a"}),
+		testNode(t, "10.0.0.11", "worker-1", "worker", map[string]string{"zone": "a", "disk": "ssd"}),
+		testNode(t, "10.0.1.12", "worker-2", "worker", map[string]string{"zone": "b"}),
+	}
+	tests := []struct {
+		name  string
+		terms []string
+		want  []string
+	}{
+		{name: "empty selects all", terms: nil, want: []string{"master-1", "worker-1", "worker-2"}},
+		{name: "role", terms: []string{"role=Worker"}, want: []string{"worker-1", "worker-2"}},
+		{name: "roles are alternatives", terms: []string{"role=controlplane", "role=worker"}, want: []string{"master-1", "worker-1", "worker-2"}},
+		{name: "hostname glob", terms: []string{"hostname=*-1"}, want: []string{"master-1", "worker-1"}},
+		{name: "address", terms: []string{"10.0.1.12"}, want: []string{"worker-2"}},
+		{name: "cidr or address", terms: []string{"10.0.0.0/24", "address=10.0.1.12"}, want: []string{"master-1", "worker-1", "worker-2"}},
+		{name: "keys must all match", terms: []string{"role=worker", "zone=a"}, want: []string{"worker-1"}},
+		{name: "label key is case insensitive", terms: []string{"ZONE=b"}, want: []string{"worker-2"}},
+		{name: "missing label", terms: []string{"disk=hdd", "disk=ssd"}, want: []string{"worker-1"}},
+		{name: "nothing", terms: []string{"role=etcd", "zone=b"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSelector(tt.terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, n := range nodes {
+				if s.Match(n) {
+					got = append(got, n.GetHostname())
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("matched %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
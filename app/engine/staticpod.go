@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"fmt"
+	"k8s-tool/app/node"
+	"strings"
+)
+
+const (
+	manifestDir       = "/etc/kubernetes/manifests"
+	manifestBackupDir = "/etc/kubernetes/manifests.stopped"
+)
+
+// stopStaticPods moves the manifests of pods away so kubelet stops them and
+// waits for their processes to exit.
+func stopStaticPods(n node.Node, pods ...string) error {
+	var wait []string
+	for _, pod := range pods {
+		// pgrep 只匹配进程名的前 15 个字符
+		name := pod
+		if len(name) > 15 {
+			name = name[:15]
+		}
+		wait = append(wait, fmt.Sprintf("pgrep -x %s >/dev/null", name))
+	}
+	_, err := n.Run("",
+		fmt.Sprintf("sudo mkdir -p %s", manifestBackupDir),
+		fmt.Sprintf("for f in %s; do if [ -e %s/$f.yaml ]; then sudo mv %s/$f.yaml %s/; fi; done",
+			strings.Join(pods, " "), manifestDir, manifestDir, manifestBackupDir),
+		fmt.Sprintf("for i in $(seq 60); do { %s; } || exit 0; sleep 2; done; echo 'static pods are still running' >&2; exit 1",
+			strings.Join(wait, " || ")),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: stop %s: %w", n.GetHostname(), strings.Join(pods, ", "), err)
+	}
+	return nil
+}
+
+// startStaticPods moves the manifests stopped by stopStaticPods back.
+func startStaticPods(n node.Node) error {
+	_, err := n.Run("",
+		fmt.Sprintf("if [ -d %s ]; then sudo sh -c 'mv %s/*.yaml %s/ 2>/dev/null; rmdir %s'; fi",
+			manifestBackupDir, manifestBackupDir, manifestDir, manifestBackupDir),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: start static pods: %w", n.GetHostname(), err)
+	}
+	return nil
+}
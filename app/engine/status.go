@@ -0,0 +1,371 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s-tool/app/node"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// NodeStatus is a node of the cluster, or of the config when it is missing
+// from the cluster.
+type NodeStatus struct {
+	Name           string
+	Address        string
+	Ready          bool
+	Roles          []string
+	KubeletVersion string
+	InCluster      bool
+	InConfig       bool
+	Drift          []string
+}
+
+// PodStatus is a control plane static pod.
+type PodStatus struct {
+	Name  string
+	Node  string
+	Phase string
+	Ready bool
+}
+
+// WorkloadStatus is the rollout state of an add-on daemonset or deployment.
+type WorkloadStatus struct {
+	Namespace string
+	Kind      string
+	Name      string
+	Desired   int
+	Ready     int
+	Updated   int
+}
+
+// Rolled reports whether every replica is updated and ready.
+func (w WorkloadStatus) Rolled() bool {
+	return w.Desired > 0 && w.Ready == w.Desired && w.Updated == w.Desired
+}
+
+// ProbeStatus is the result of a check run on a node.
+type ProbeStatus struct {
+	Check string
+	Node  string
+	State string
+	OK    bool
+}
+
+// Status summarizes the cluster as seen from the master and the nodes.
+type Status struct {
+	Nodes        []NodeStatus
+	ControlPlane []PodStatus
+	Workloads    []WorkloadStatus
+	Probes       []ProbeStatus
+}
+
+// Drifted reports whether the cluster differs from the config.
+func (s *Status) Drifted() bool {
+	for _, n := range s.Nodes {
+		if len(n.Drift) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// statusWorkloads are the add-ons whose rollout is reported.
+var statusWorkloads = map[string]bool{
+	"calico-node":             true,
+	"calico-kube-controllers": true,
+	"kube-flannel-ds":         true,
+	"cilium":                  true,
+	"cilium-operator":         true,
+	"coredns":                 true,
+	"istiod":                  true,
+	"istio-ingressgateway":    true,
+}
+
+// Status connects to the nodes and collects the cluster status. Nodes that
+// cannot be reached are reported as probes instead of failing, except the
+// master which runs kubectl.
+func (e *Engine) Status() (*Status, error) {
+	if err := e.check(); err != nil {
+		return nil, err
+	}
+	defer e.closeAll()
+	if err := e.connectMaster(); err != nil {
+		return nil, err
+	}
+
+	s := &Status{}
+	reachable, unreachable := e.connectReachable()
+	for addr, err := range unreachable {
+		s.Probes = append(s.Probes, ProbeStatus{Check: "ssh", Node: addr, State: err.Error()})
+	}
+
+	live, err := e.liveNodes()
+	if err != nil {
+		return nil, err
+	}
+	s.Nodes = e.nodeStatus(live)
+	if s.ControlPlane, err = e.controlPlanePods(); err != nil {
+		return nil, err
+	}
+	if s.Workloads, err = e.workloadStatus(); err != nil {
+		return nil, err
+	}
+	s.Probes = append(s.Probes, e.probe(reachable)...)
+	sort.SliceStable(s.Probes, func(i, j int) bool {
+		if s.Probes[i].Check != s.Probes[j].Check {
+			return s.Probes[i].Check < s.Probes[j].Check
+		}
+		return s.Probes[i].Node < s.Probes[j].Node
+	})
+	return s, nil
+}
+
+// connectReachable connects the nodes other than the master, which must be
+// connected already, and returns the ones that could be reached.
+func (e *Engine) connectReachable() ([]node.Node, map[string]error) {
+	reachable := []node.Node{e.master}
+	unreachable := map[string]error{}
+	var mu sync.Mutex
+	var eg errgroup.Group
+	for _, n := range e.nodes {
+		if n == e.master {
+			continue
+		}
+		eg.Go(func() error {
+			err := n.Connect()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				unreachable[n.GetAddress()] = err
+			} else {
+				reachable = append(reachable, n)
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+	return reachable, unreachable
+}
+
+// nodeStatus merges the live nodes with the config nodes and notes where
+// they differ.
+func (e *Engine) nodeStatus(live []liveNode) []NodeStatus {
+	var nodes []NodeStatus
+	matched := map[string]bool{}
+	for _, l := range live {
+		ns := NodeStatus{
+			Name:           l.Name,
+			Address:        l.InternalIP,
+			Ready:          l.Ready,
+			Roles:          l.Roles,
+			KubeletVersion: l.KubeletVersion,
+			InCluster:      true,
+		}
+		if !l.Ready {
+			ns.Drift = append(ns.Drift, "not Ready")
+		}
+		if e.kubeadm.pinned && l.KubeletVersion != e.kubeadm.version {
+			ns.Drift = append(ns.Drift, fmt.Sprintf("kubelet %s, config %s", l.KubeletVersion, e.kubeadm.version))
+		}
+		var cfg node.Node
+		for _, n := range e.nodes {
+			if n.GetHostname() == l.Name || n.GetAddress() == l.InternalIP {
+				cfg = n
+				break
+			}
+		}
+		if cfg == nil {
+			ns.Drift = append(ns.Drift, "not in config")
+		} else {
+			ns.InConfig = true
+			matched[cfg.GetAddress()] = true
+			if cfg.GetHostname() != l.Name {
+				ns.Drift = append(ns.Drift, fmt.Sprintf("config hostname %s", cfg.GetHostname()))
+			}
+			if cfg.GetAddress() != l.InternalIP {
+				ns.Drift = append(ns.Drift, fmt.Sprintf("config address %s", cfg.GetAddress()))
+			}
+		}
+		nodes = append(nodes, ns)
+	}
+	for _, n := range e.nodes {
+		if matched[n.GetAddress()] {
+			continue
+		}
+		nodes = append(nodes, NodeStatus{
+			Name:     n.GetHostname(),
+			Address:  n.GetAddress(),
+			Roles:    n.GetRole(),
+			InConfig: true,
+			Drift:    []string{"not in cluster"},
+		})
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
+
+func (e *Engine) controlPlanePods() ([]PodStatus, error) {
+	out, err := e.master.Run("", "kubectl -n kube-system get pods -l tier=control-plane -o json")
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec struct {
+				NodeName string `json:"nodeName"`
+			} `json:"spec"`
+			Status struct {
+				Phase      string `json:"phase"`
+				Conditions []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("parse control plane pods: %w", err)
+	}
+	pods := make([]PodStatus, 0, len(list.Items))
+	for _, item := range list.Items {
+		p := PodStatus{Name: item.Metadata.Name, Node: item.Spec.NodeName, Phase: item.Status.Phase}
+		for _, c := range item.Status.Conditions {
+			if c.Type == "Ready" {
+				p.Ready = c.Status == "True"
+			}
+		}
+		pods = append(pods, p)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+func (e *Engine) workloadStatus() ([]WorkloadStatus, error) {
+	out, err := e.master.Run("", "kubectl get daemonsets,deployments -A -o json")
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Namespace string `json:"namespace"`
+				Name      string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				DesiredNumberScheduled int `json:"desiredNumberScheduled"`
+				NumberReady            int `json:"numberReady"`
+				UpdatedNumberScheduled int `json:"updatedNumberScheduled"`
+				Replicas               int `json:"replicas"`
+				ReadyReplicas          int `json:"readyReplicas"`
+				UpdatedReplicas        int `json:"updatedReplicas"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("parse workloads: %w", err)
+	}
+	var workloads []WorkloadStatus
+	for _, item := range list.Items {
+		if !statusWorkloads[item.Metadata.Name] {
+			continue
+		}
+		w := WorkloadStatus{Namespace: item.Metadata.Namespace, Kind: strings.ToLower(item.Kind), Name: item.Metadata.Name}
+		if item.Kind == "DaemonSet" {
+			w.Desired, w.Ready, w.Updated = item.Status.DesiredNumberScheduled, item.Status.NumberReady, item.Status.UpdatedNumberScheduled
+		} else {
+			w.Desired, w.Ready, w.Updated = item.Status.Replicas, item.Status.ReadyReplicas, item.Status.UpdatedReplicas
+		}
+		workloads = append(workloads, w)
+	}
+	sort.Slice(workloads, func(i, j int) bool { return workloads[i].Name < workloads[j].Name })
+	return workloads, nil
+}
+
+// probe checks the VIP holder, haproxy and the NFS mounts on the reachable
+// nodes.
+func (e *Engine) probe(nodes []node.Node) []ProbeStatus {
+	var (
+		mu     sync.Mutex
+		probes []ProbeStatus
+		eg     errgroup.Group
+	)
+	add := func(p ProbeStatus) {
+		mu.Lock()
+		probes = append(probes, p)
+		mu.Unlock()
+	}
+	for _, n := range nodes {
+		eg.Go(func() error {
+			if e.vip != "" && ((e.lb.mode == lbHaproxy && n.IsETCD()) || (e.lb.mode == lbKubeVip && n.IsControl())) {
+				out, _ := n.Run("", fmt.Sprintf("ip -o addr show | grep -qw %s && echo holder || echo standby", shellQuote(e.vip)))
+				state := strings.TrimSpace(string(out))
+				add(ProbeStatus{Check: "vip " + e.vip, Node: n.GetHostname(), State: state, OK: state != ""})
+			}
+			if e.lb.mode == lbHaproxy && n.IsETCD() {
+				out, _ := n.Run("", "systemctl is-active haproxy || true")
+				state := strings.TrimSpace(string(out))
+				add(ProbeStatus{Check: "haproxy", Node: n.GetHostname(), State: state, OK: state == "active"})
+				for _, cp := range e.nodes {
+					if !cp.IsControl() {
+						continue
+					}
+					out, _ := n.Run("", fmt.Sprintf(
+						"curl -sk -o /dev/null -m 5 -w '%%{http_code}' https://%s:6443/healthz || true",
+						urlHost(cp.GetAddress())))
+					code := strings.TrimSpace(string(out))
+					add(ProbeStatus{Check: "haproxy backend " + cp.GetHostname(), Node: n.GetHostname(), State: "healthz " + code, OK: code == "200"})
+				}
+			}
+			if e.nfs.server != "" {
+				source := e.nfs.server + ":" + e.nfs.path
+				if n == e.master {
+					out, _ := n.Run("", fmt.Sprintf("timeout 10 showmount -e %s 2>&1 | grep -q '^%s ' && echo exported || echo 'not exported'",
+						shellQuote(e.nfs.server), e.nfs.path))
+					state := strings.TrimSpace(string(out))
+					add(ProbeStatus{Check: "nfs export " + source, Node: n.GetHostname(), State: state, OK: state == "exported"})
+				}
+				// 只有运行了使用 nfs 卷的 pod 的节点才会挂载
+				out, _ := n.Run("", fmt.Sprintf("findmnt -rn -S %s >/dev/null && echo mounted || echo 'not mounted'", shellQuote(source)))
+				add(ProbeStatus{Check: "nfs mount " + source, Node: n.GetHostname(), State: strings.TrimSpace(string(out)), OK: true})
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+
+	// 没有任何节点持有 vip 时单独报告
+	holders := 0
+	vipProbes := 0
+	for _, p := range probes {
+		if strings.HasPrefix(p.Check, "vip ") {
+			vipProbes++
+			if p.State == "holder" {
+				holders++
+			}
+		}
+	}
+	if vipProbes > 0 && holders != 1 {
+		for i := range probes {
+			if strings.HasPrefix(probes[i].Check, "vip ") {
+				probes[i].OK = false
+			}
+		}
+	}
+	return probes
+}
+
+// urlHost brackets IPv6 addresses for use in a URL.
+func urlHost(addr string) string {
+	if strings.Contains(addr, ":") {
+		return "[" + addr + "]"
+	}
+	return addr
+}
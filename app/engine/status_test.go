@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// kubectlNode is a node as printed by kubectl get nodes -o json. labels are
+// key=value pairs, taints key:effect pairs.
+func kubectlNode(name, ip string, ready bool, version string, labels, taints []string) string {
+	var l, t []string
+	for _, kv := range labels {
+		k, v, _ := strings.Cut(kv, "=")
+		l = append(l, fmt.Sprintf("%q: %q", k, v))
+	}
+	for _, kv := range taints {
+		k, effect, _ := strings.Cut(kv, ":")
+		t = append(t, fmt.Sprintf(`{"key": %q, "effect": %q}`, k, effect))
+	}
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	return fmt.Sprintf(`{
+  "metadata": {"name": %q, "labels": {%s}},
+  "spec": {"taints": [%s]},
+  "status": {
+    "addresses": [{"type": "Hostname", "address": %q}, {"type": "InternalIP", "address": %q}],
+    "conditions": [{"type": "MemoryPressure", "status": "False"}, {"type": "Ready", "status": %q}],
+    "nodeInfo": {"kubeletVersion": %q}
+  }
+}`, name, strings.Join(l, ", "), strings.Join(t, ", "), name, ip, status, version)
+}
+
+// kubectlReply answers kubectl get nodes with items and the other kubectl
+// get commands with the canned output in gets, keyed by resource.
+func kubectlReply(items []string, gets map[string]string) func(hostname, cmd string) (string, error) {
+	return func(hostname, cmd string) (string, error) {
+		if cmd == "kubectl get nodes -o json" {
+			return `{"apiVersion": "v1", "kind": "List", "items": [` + strings.Join(items, ",\n") + `]}`, nil
+		}
+		for resource, out := range gets {
+			if strings.Contains(cmd, " get "+resource+" ") {
+				return out, nil
+			}
+		}
+		return "", nil
+	}
+}
+
+func TestNodeStatus(t *testing.T) {
+	controlPlane := []string{"node-role.kubernetes.io/control-plane="}
+	tests := []struct {
+		name    string
+		opts    []Option
+		live    []string
+		want    map[string][]string
+		inCfg   map[string]bool
+		drifted bool
+	}{
+		{
+			name: "in sync",
+			opts: []Option{KubernetesVersion("v1.28.2")},
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", controlPlane, nil),
+				kubectlNode("node2", "10.0.0.2", true, "v1.28.2", nil, nil),
+			},
+			want:  map[string][]string{"node1": nil, "node2": nil},
+			inCfg: map[string]bool{"node1": true, "node2": true},
+		},
+		{
+			name: "not ready and old kubelet",
+			opts: []Option{KubernetesVersion("1.28.2")},
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", controlPlane, nil),
+				kubectlNode("node2", "10.0.0.2", false, "v1.27.6", nil, nil),
+			},
+			want:    map[string][]string{"node1": nil, "node2": {"not Ready", "kubelet v1.27.6, config v1.28.2"}},
+			inCfg:   map[string]bool{"node1": true, "node2": true},
+			drifted: true,
+		},
+		{
+			name: "kubelet version not pinned",
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", controlPlane, nil),
+				kubectlNode("node2", "10.0.0.2", true, "v1.27.6", nil, nil),
+			},
+			want:  map[string][]string{"node1": nil, "node2": nil},
+			inCfg: map[string]bool{"node1": true, "node2": true},
+		},
+		{
+			name: "renamed and moved",
+			live: []string{
+				kubectlNode("node1", "10.0.0.11", true, "v1.28.2", controlPlane, nil),
+				kubectlNode("worker-2", "10.0.0.2", true, "v1.28.2", nil, nil),
+			},
+			want:    map[string][]string{"node1": {"config address 10.0.0.1"}, "worker-2": {"config hostname node2"}},
+			inCfg:   map[string]bool{"node1": true, "worker-2": true},
+			drifted: true,
+		},
+		{
+			name: "missing and extra",
+			live: []string{
+				kubectlNode("node1", "10.0.0.1", true, "v1.28.2", controlPlane, nil),
+				kubectlNode("node9", "10.0.0.9", true, "v1.28.2", nil, nil),
+			},
+			want:    map[string][]string{"node1": nil, "node2": {"not in cluster"}, "node9": {"not in config"}},
+			inCfg:   map[string]bool{"node1": true, "node2": true},
+			drifted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newFakeEngine(t, tt.opts, kubectlReply(tt.live, nil), "10.0.0.1:etcd,controlplane", "10.0.0.2:worker")
+			live, err := e.liveNodes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &Status{Nodes: e.nodeStatus(live)}
+			got := map[string][]string{}
+			for _, n := range s.Nodes {
+				got[n.Name] = n.Drift
+				if n.InConfig != tt.inCfg[n.Name] {
+					t.Errorf("%s InConfig = %v, want %v", n.Name, n.InConfig, tt.inCfg[n.Name])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("drift = %v, want %v", got, tt.want)
+			}
+			if s.Drifted() != tt.drifted {
+				t.Fatalf("Drifted() = %v, want %v", s.Drifted(), tt.drifted)
+			}
+		})
+	}
+}
+
+func TestLiveNodes(t *testing.T) {
+	e, _ := newFakeEngine(t, nil, kubectlReply([]string{
+		kubectlNode("node1", "10.0.0.1", true, "v1.28.2",
+			[]string{"node-role.kubernetes.io/control-plane=", "node-role.kubernetes.io/etcd=", "zone=a"},
+			[]string{"node-role.kubernetes.io/control-plane:NoSchedule"}),
+	}, nil), "10.0.0.1:etcd,controlplane,worker")
+	live, err := e.liveNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []liveNode{{
+		Name:           "node1",
+		InternalIP:     "10.0.0.1",
+		Ready:          true,
+		Roles:          []string{"control-plane", "etcd"},
+		KubeletVersion: "v1.28.2",
+		Labels:         map[string]string{"node-role.kubernetes.io/control-plane": "", "node-role.kubernetes.io/etcd": "", "zone": "a"},
+		Taints:         []string{"node-role.kubernetes.io/control-plane:NoSchedule"},
+	}}
+	if !reflect.DeepEqual(live, want) {
+		t.Fatalf("liveNodes() = %+v, want %+v", live, want)
+	}
+}
+
+func TestWorkloadStatus(t *testing.T) {
+	const workloads = `{"items": [
+  {"kind": "DaemonSet", "metadata": {"namespace": "kube-system", "name": "calico-node"},
+   "status": {"desiredNumberScheduled": 3, "numberReady": 3, "updatedNumberScheduled": 2}},
+  {"kind": "Deployment", "metadata": {"namespace": "kube-system", "name": "coredns"},
+   "status": {"replicas": 2, "readyReplicas": 2, "updatedReplicas": 2}},
+  {"kind": "Deployment", "metadata": {"namespace": "default", "name": "web"},
+   "status": {"replicas": 1, "readyReplicas": 1, "updatedReplicas": 1}}
+]}`
+	e, _ := newFakeEngine(t, nil, kubectlReply(nil, map[string]string{"daemonsets,deployments": workloads}), "10.0.0.1:etcd,controlplane,worker")
+	got, err := e.workloadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []WorkloadStatus{
+		{Namespace: "kube-system", Kind: "daemonset", Name: "calico-node", Desired: 3, Ready: 3, Updated: 2},
+		{Namespace: "kube-system", Kind: "deployment", Name: "coredns", Desired: 2, Ready: 2, Updated: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("workloadStatus() = %+v, want %+v", got, want)
+	}
+	if got[0].Rolled() || !got[1].Rolled() {
+		t.Fatalf("Rolled() = %v, %v, want false, true", got[0].Rolled(), got[1].Rolled())
+	}
+}
+
+func TestControlPlanePods(t *testing.T) {
+	const pods = `{"items": [
+  {"metadata": {"name": "kube-scheduler-node1"}, "spec": {"nodeName": "node1"},
+   "status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "False"}]}},
+  {"metadata": {"name": "kube-apiserver-node1"}, "spec": {"nodeName": "node1"},
+   "status": {"phase": "Running", "conditions": [{"type": "Initialized", "status": "True"}, {"type": "Ready", "status": "True"}]}}
+]}`
+	e, _ := newFakeEngine(t, nil, kubectlReply(nil, map[string]string{"pods": pods}), "10.0.0.1:etcd,controlplane,worker")
+	got, err := e.controlPlanePods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PodStatus{
+		{Name: "kube-apiserver-node1", Node: "node1", Phase: "Running", Ready: true},
+		{Name: "kube-scheduler-node1", Node: "node1", Phase: "Running"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("controlPlanePods() = %+v, want %+v", got, want)
+	}
+}
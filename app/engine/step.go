@@ -44,14 +44,14 @@ var DeploySteps = []*Step{
 	{Num: 1, Name: "connect", run: func(e *Engine) error { return e.connect() }},
 	{Num: 2, Name: "init", run: func(e *Engine) error { return e.init() }},
 	{Num: 3, Name: "install chrony", run: func(e *Engine) error { return e.installChrony() }},
-	{Num: 4, Name: "install docker", run: func(e *Engine) error { return e.installDocker() }},
-	{Num: 5, Name: "load docker image", run: func(e *Engine) error { return e.loadDockerImage() }},
+	{Num: 4, Name: "install container runtime", run: func(e *Engine) error { return e.installRuntime() }},
+	{Num: 5, Name: "load images", run: func(e *Engine) error { return e.loadRuntimeImages() }},
 	{Num: 6, Name: "install kubeadm", run: func(e *Engine) error { return e.installKubeadm() }},
 	{Num: 7, Name: "install helm", run: func(e *Engine) error { return e.installHelm() }},
-	{Num: 8, Name: "install haproxy", run: func(e *Engine) error { return e.installHa() }},
-	{Num: 9, Name: "install keepalived", run: func(e *Engine) error { return e.installKeepalived() }},
+	{Num: 8, Name: "install load balancer", run: func(e *Engine) error { return e.installLoadBalancer() }},
+	{Num: 9, Name: "install vip", run: func(e *Engine) error { return e.installVIP() }},
 	{Num: 10, Name: "start k8s", run: func(e *Engine) error { return e.startK8s() }},
-	{Num: 11, Name: "install calico", run: func(e *Engine) error { return e.installCalico() }},
+	{Num: 11, Name: "install network", run: func(e *Engine) error { return e.installNetwork() }},
 	{Num: 12, Name: "mount storage", run: func(e *Engine) error { return e.installNFS() }},
 	{Num: 13, Name: "install istio", run: func(e *Engine) error { return e.installIstio() }},
 	{Num: 14, Name: "install app", run: func(e *Engine) error { return e.installApp() }},
@@ -63,9 +63,17 @@ var UpdateSteps = []*Step{
 	{Num: 2, Name: "check new", run: func(e *Engine) error { return e.checkNew() }},
 	{Num: 3, Name: "init", run: func(e *Engine) error { return e.init() }},
 	{Num: 4, Name: "install chrony", run: func(e *Engine) error { return e.installChrony() }},
-	{Num: 5, Name: "install docker", run: func(e *Engine) error { return e.installDocker() }},
-	{Num: 6, Name: "load docker image", run: func(e *Engine) error { return e.loadDockerImage() }},
+	{Num: 5, Name: "install container runtime", run: func(e *Engine) error { return e.installRuntime() }},
+	{Num: 6, Name: "load images", run: func(e *Engine) error { return e.loadRuntimeImages() }},
 	{Num: 7, Name: "install kubeadm", run: func(e *Engine) error { return e.installKubeadm() }},
 	{Num: 8, Name: "install nfs", run: func(e *Engine) error { return e.installNFSUtils() }},
 	{Num: 9, Name: "join node", run: func(e *Engine) error { return e.join() }},
+	{Num: 10, Name: "update load balancer", run: func(e *Engine) error { return e.updateLoadBalancer() }},
+}
+
+// reset
+var ResetSteps = []*Step{
+	{Num: 1, Name: "connect", run: func(e *Engine) error { return e.connect() }},
+	{Num: 2, Name: "reset k8s", run: func(e *Engine) error { return e.resetK8s() }},
+	{Num: 3, Name: "stop load balancer", run: func(e *Engine) error { return e.stopLoadBalancer() }},
 }
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"k8s-tool/app/node"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// userPath makes a relative remote path relative to the home directory
+// instead of the resource directory node resolves it against.
+func userPath(p string) string {
+	if strings.HasPrefix(p, "~") || path.IsAbs(p) {
+		return p
+	}
+	return "~/" + p
+}
+
+// eachSelected connects the nodes matching s and runs fn on each of them
+// concurrently. A failing node does not stop the others, the errors of all
+// nodes are returned together.
+func (e *Engine) eachSelected(s Selector, fn func(n node.Node) error) error {
+	nodes, err := e.Select(s)
+	if err != nil {
+		return err
+	}
+	defer e.closeAll()
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		eg   errgroup.Group
+	)
+	for _, n := range nodes {
+		eg.Go(func() error {
+			err := n.Connect()
+			if err == nil {
+				err = fn(n)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", nodeName(n), err))
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+	return errors.Join(errs...)
+}
+
+// homeRelative rewrites a ~ path for commands, which start in the home
+// directory.
+func homeRelative(p string) string {
+	if rest, ok := strings.CutPrefix(p, "~"); ok {
+		return "./" + strings.TrimPrefix(rest, "/")
+	}
+	return p
+}
+
+// copyTarget is where src ends up on n, following cp: a dst ending in / or
+// naming an existing directory receives src under its base name.
+func copyTarget(n node.Node, src, dst string) (string, error) {
+	base := filepath.Base(src)
+	if strings.HasSuffix(dst, "/") {
+		return path.Join(dst, base), nil
+	}
+	out, err := n.Run("", fmt.Sprintf("if [ -d %s ]; then echo dir; fi", shellQuote(homeRelative(dst))))
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(out)) == "dir" {
+		return path.Join(dst, base), nil
+	}
+	return dst, nil
+}
+
+// copyTo uploads src to tmp under the home directory of the SSH user and
+// moves it into place with sudo, since SFTP cannot write to root-owned
+// paths. The SSH user stays the owner unless owner is set.
+func copyTo(n node.Node, src, dst, tmp, mode, owner string) error {
+	target, err := copyTarget(n, src, dst)
+	if err != nil {
+		return err
+	}
+	staged := shellQuote(homeRelative(tmp))
+	defer n.Run("", "rm -rf "+staged)
+	if err := n.Upload(src, tmp); err != nil {
+		return err
+	}
+	quoted := shellQuote(homeRelative(target))
+	cmds := []string{
+		fmt.Sprintf("sudo mkdir -p %s", shellQuote(homeRelative(path.Dir(target)))),
+		fmt.Sprintf("sudo cp -rT --preserve=mode,ownership,timestamps %s %s", staged, quoted),
+	}
+	if mode != "" {
+		cmds = append(cmds, fmt.Sprintf("sudo chmod -R %s %s", mode, quoted))
+	}
+	if owner != "" {
+		cmds = append(cmds, fmt.Sprintf("sudo chown -R %s %s", shellQuote(owner), quoted))
+	}
+	_, err = n.Run("", cmds...)
+	return err
+}
+
+// Copy uploads the local file or directory src to dst on the nodes matching
+// s. Like cp, a dst ending in / or naming an existing directory receives src
+// under its base name. mode (octal, e.g. 0644) and owner (user[:group]) are
+// applied recursively when set. Relative dst paths are relative to the home
+// directory.
+func (e *Engine) Copy(s Selector, src, dst, mode, owner string) error {
+	if mode != "" {
+		if _, err := strconv.ParseUint(mode, 8, 32); err != nil {
+			return fmt.Errorf("invalid mode %q", mode)
+		}
+	}
+	dst = userPath(dst)
+	tmp := fmt.Sprintf("~/.k8s-tool-cp-%d", time.Now().UnixNano())
+	return e.eachSelected(s, func(n node.Node) error {
+		return copyTo(n, src, dst, tmp, mode, owner)
+	})
+}
+
+// Fetch downloads src from the nodes matching s into dir/<hostname>/, keeping
+// the base name of src. Relative src paths are relative to the home
+// directory.
+func (e *Engine) Fetch(s Selector, src, dir string) error {
+	src = userPath(src)
+	base := path.Base(strings.TrimRight(src, "/"))
+	if base == "~" || base == "/" || base == "." {
+		base = ""
+	}
+	return e.eachSelected(s, func(n node.Node) error {
+		return n.Download(src, filepath.Join(dir, nodeName(n), base))
+	})
+}
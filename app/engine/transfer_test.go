@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"errors"
+	"k8s-tool/app/node"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dirNode answers the directory test of copyTarget from dirs and records
+// the other commands and uploads.
+type dirNode struct {
+	node.Node
+	dirs      []string
+	uploadErr error
+	cmds      []string
+}
+
+func (n *dirNode) Run(cwd string, cmds ...string) ([]byte, error) {
+	for _, d := range n.dirs {
+		if strings.Contains(cmds[0], "[ -d "+shellQuote(d)+" ]") {
+			return []byte("dir\n"), nil
+		}
+	}
+	if !strings.HasPrefix(cmds[0], "if [ -d ") {
+		n.cmds = append(n.cmds, cmds...)
+	}
+	return nil, nil
+}
+
+func (n *dirNode) Upload(src, dst string) error {
+	n.cmds = append(n.cmds, "upload "+src+" "+dst)
+	return n.uploadErr
+}
+
+func TestCopyTarget(t *testing.T) {
+	n := &dirNode{dirs: []string{"/tmp", "./conf"}}
+	tests := []struct {
+		name string
+		src  string
+		dst  string
+		want string
+	}{
+		{name: "new file", src: "file.txt", dst: "/etc/file.conf", want: "/etc/file.conf"},
+		{name: "trailing slash", src: "./dist/file.txt", dst: "/opt/app/", want: "/opt/app/file.txt"},
+		{name: "existing directory", src: "file.txt", dst: "/tmp", want: "/tmp/file.txt"},
+		{name: "existing home directory", src: "file.txt", dst: "~/conf", want: "~/conf/file.txt"},
+		{name: "home", src: "file.txt", dst: "~/", want: "~/file.txt"},
+		{name: "directory into directory", src: "./manifests/", dst: "/tmp", want: "/tmp/manifests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := copyTarget(n, tt.src, tt.dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("copyTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	tests := []struct {
+		name      string
+		dst       string
+		mode      string
+		owner     string
+		uploadErr error
+		want      []string
+	}{
+		{
+			name: "root-owned file",
+			dst:  "/etc/containers/registries.conf",
+			want: []string{
+				"upload registries.conf ~/.k8s-tool-cp-1",
+				"sudo mkdir -p '/etc/containers'",
+				"sudo cp -rT --preserve=mode,ownership,timestamps './.k8s-tool-cp-1' '/etc/containers/registries.conf'",
+				"rm -rf './.k8s-tool-cp-1'",
+			},
+		},
+		{
+			name:  "mode and owner into directory",
+			dst:   "/tmp",
+			mode:  "0644",
+			owner: "root:root",
+			want: []string{
+				"upload registries.conf ~/.k8s-tool-cp-1",
+				"sudo mkdir -p '/tmp'",
+				"sudo cp -rT --preserve=mode,ownership,timestamps './.k8s-tool-cp-1' '/tmp/registries.conf'",
+				"sudo chmod -R 0644 '/tmp/registries.conf'",
+				"sudo chown -R 'root:root' '/tmp/registries.conf'",
+				"rm -rf './.k8s-tool-cp-1'",
+			},
+		},
+		{
+			name: "home",
+			dst:  "~/",
+			want: []string{
+				"upload registries.conf ~/.k8s-tool-cp-1",
+				"sudo mkdir -p './'",
+				"sudo cp -rT --preserve=mode,ownership,timestamps './.k8s-tool-cp-1' './registries.conf'",
+				"rm -rf './.k8s-tool-cp-1'",
+			},
+		},
+		{
+			name:      "failed upload is cleaned up",
+			dst:       "/etc/containers/registries.conf",
+			uploadErr: errors.New("connection lost"),
+			want: []string{
+				"upload registries.conf ~/.k8s-tool-cp-1",
+				"rm -rf './.k8s-tool-cp-1'",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &dirNode{dirs: []string{"/tmp"}, uploadErr: tt.uploadErr}
+			err := copyTo(n, "registries.conf", tt.dst, "~/.k8s-tool-cp-1", tt.mode, tt.owner)
+			if !errors.Is(err, tt.uploadErr) {
+				t.Fatalf("copyTo() error = %v, want %v", err, tt.uploadErr)
+			}
+			if !reflect.DeepEqual(n.cmds, tt.want) {
+				t.Fatalf("copyTo() ran\n%s\nwant\n%s", strings.Join(n.cmds, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
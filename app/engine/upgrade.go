@@ -0,0 +1,299 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"k8s-tool/app/node"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// upgrade
+var UpgradeSteps = []*Step{
+	{Num: 1, Name: "connect", run: func(e *Engine) error { return e.connect() }},
+	{Num: 2, Name: "check upgrade", run: func(e *Engine) error { return e.checkUpgrade() }},
+	{Num: 3, Name: "upload packages", run: func(e *Engine) error { return e.uploadPackages() }},
+	{Num: 4, Name: "upgrade first control plane", run: func(e *Engine) error { return e.upgradeFirstControlPlane() }},
+	{Num: 5, Name: "upgrade control planes", run: func(e *Engine) error { return e.upgradeControlPlanes() }},
+	{Num: 6, Name: "upgrade workers", run: func(e *Engine) error { return e.upgradeWorkers() }},
+}
+
+// Upgrade moves the cluster to the pinned kubernetesVersion node by node.
+func (e *Engine) Upgrade(steps string) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if !e.kubeadm.pinned {
+		return errors.New("kubernetesVersion must be set to the version to upgrade to")
+	}
+	defer e.closeAll()
+	if len(steps) > 0 {
+		nums, err := parseStepNums(steps, len(UpgradeSteps))
+		if err != nil {
+			return err
+		}
+		required := []int{1}
+		for _, n := range nums {
+			if n > 2 {
+				required = append(required, 2)
+				break
+			}
+		}
+		nums = prependMissingSteps(nums, required...)
+		for _, n := range nums {
+			if err := UpgradeSteps[n-1].install(e); err != nil {
+				return err
+			}
+		}
+		e.collectVersion()
+		return nil
+	}
+	for _, step := range UpgradeSteps {
+		if err := step.install(e); err != nil {
+			return err
+		}
+	}
+	e.collectVersion()
+	return nil
+}
+
+// minorVersion returns the major and minor numbers of v1.28.2.
+func minorVersion(v string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid version %q", v)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q", v)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q", v)
+	}
+	return major, minor, nil
+}
+
+// checkUpgrade makes sure every configured Kubernetes node is in the cluster
+// and Ready and that kubeadm supports going from the cluster version to the
+// target. Nodes with neither the controlplane nor the worker role, such as
+// etcd-only load balancers, are not part of the cluster and are left alone.
+func (e *Engine) checkUpgrade() error {
+	current, err := e.clusterVersion()
+	if err != nil {
+		return err
+	}
+	target := e.kubeadm.version
+	cm, cn, err := minorVersion(current)
+	if err != nil {
+		return err
+	}
+	tm, tn, err := minorVersion(target)
+	if err != nil {
+		return err
+	}
+	switch {
+	case tm != cm:
+		return fmt.Errorf("cannot upgrade from %s to %s across major versions", current, target)
+	case tn < cn:
+		return fmt.Errorf("cannot downgrade from %s to %s", current, target)
+	case tn > cn+1:
+		return fmt.Errorf("cannot upgrade from %s to %s: kubeadm upgrades one minor version at a time", current, target)
+	}
+	e.log.Infof("Upgrading cluster from %s to %s", current, target)
+
+	res, err := e.master.Run("", "kubectl get nodes -o jsonpath='{.items[*].metadata.name}'")
+	if err != nil {
+		return err
+	}
+	names := map[string]struct{}{}
+	for _, name := range strings.Fields(string(res)) {
+		names[name] = struct{}{}
+	}
+	for _, n := range e.nodes {
+		n.SetIsNew(false)
+		if !isKubeNode(n) {
+			continue
+		}
+		if _, ok := names[n.GetHostname()]; !ok {
+			return fmt.Errorf("%s: node %s is not in the cluster, join it with --update first", n.GetAddress(), n.GetHostname())
+		}
+	}
+	return e.runChecks(nodesReadyCheck)
+}
+
+// isKubeNode reports whether n runs kubelet.
+func isKubeNode(n node.Node) bool {
+	return n.IsControl() || n.IsWorker()
+}
+
+// uploadPackages copies the kubeadm bundle of the target version to every
+// node and loads the images it ships, before any node is touched.
+func (e *Engine) uploadPackages() error {
+	name := e.kubeadmResource()
+	_, err := os.Stat(filepath.Join("resource", name, "images"))
+	hasImages := err == nil
+
+	var eg errgroup.Group
+	for i := range e.nodes {
+		n := e.nodes[i]
+		if !isKubeNode(n) {
+			continue
+		}
+		eg.Go(func() error {
+			dir, err := e.uploadedPackage(n)
+			if err != nil {
+				return err
+			}
+			if hasImages {
+				return e.importImages(n, filepath.Join(dir, "images"))
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+// uploadedPackage returns the directory of the kubeadm bundle on n,
+// uploading it on first use.
+func (e *Engine) uploadedPackage(n node.Node) (string, error) {
+	e.upgrade.mu.Lock()
+	dir, ok := e.upgrade.uploaded[n.GetAddress()]
+	e.upgrade.mu.Unlock()
+	if ok {
+		return dir, nil
+	}
+	dir, err := n.UploadResource(e.kubeadmResource())
+	if err != nil {
+		return "", err
+	}
+	e.upgrade.mu.Lock()
+	if e.upgrade.uploaded == nil {
+		e.upgrade.uploaded = make(map[string]string)
+	}
+	e.upgrade.uploaded[n.GetAddress()] = dir
+	e.upgrade.mu.Unlock()
+	return dir, nil
+}
+
+func (e *Engine) upgradeFirstControlPlane() error {
+	version := e.kubeadm.version
+	return e.upgradeNode(e.master, func() error {
+		out, err := e.master.Run("", fmt.Sprintf("sudo kubeadm upgrade plan %s", version))
+		e.log.Info(string(out))
+		if err != nil {
+			return err
+		}
+		out, err = e.master.Run("", fmt.Sprintf("sudo kubeadm upgrade apply -y %s", version))
+		e.log.Info(string(out))
+		return err
+	})
+}
+
+// upgradeControlPlanes upgrades the other control planes one at a time.
+func (e *Engine) upgradeControlPlanes() error {
+	for _, n := range e.nodes {
+		if n == e.master || !n.IsControl() {
+			continue
+		}
+		if err := e.upgradeNode(n, func() error {
+			_, err := n.Run("", "sudo kubeadm upgrade node")
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeWorkers upgrades the workers in batches of the configured size.
+func (e *Engine) upgradeWorkers() error {
+	var workers []node.Node
+	for _, n := range e.nodes {
+		if n.IsWorker() && !n.IsControl() {
+			workers = append(workers, n)
+		}
+	}
+	for len(workers) > 0 {
+		size := min(e.upgrade.batch, len(workers))
+		batch := workers[:size]
+		workers = workers[size:]
+
+		var eg errgroup.Group
+		for i := range batch {
+			n := batch[i]
+			eg.Go(func() error {
+				return e.upgradeNode(n, func() error {
+					_, err := n.Run("", "sudo kubeadm upgrade node")
+					return err
+				})
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeNode follows the kubeadm order: it upgrades kubeadm and runs
+// upgrade, then drains n, upgrades kubelet and kubectl, restarts kubelet and
+// puts n back into service. The bundle's install.sh installs only the
+// components given as arguments.
+func (e *Engine) upgradeNode(n node.Node, upgrade func() error) error {
+	hostname := shellQuote(n.GetHostname())
+	e.log.Infof("Upgrading node %s to %s", n.GetHostname(), e.kubeadm.version)
+	dir, err := e.uploadedPackage(n)
+	if err != nil {
+		return err
+	}
+	out, err := n.Run(dir, "bash install.sh kubeadm")
+	e.log.Info(string(out))
+	if err != nil {
+		return err
+	}
+	if err := e.verifyKubeadm(n); err != nil {
+		return err
+	}
+	if v, err := kubeletVersion(n); err == nil && v == e.kubeadm.version {
+		e.log.Warnf("%s: kubelet was upgraded with kubeadm, install.sh of %s should only install the components it is given",
+			n.GetHostname(), e.kubeadmResource())
+	}
+	if err := upgrade(); err != nil {
+		return fmt.Errorf("%s: %w", n.GetHostname(), err)
+	}
+
+	if _, err := e.master.Run("", fmt.Sprintf(
+		"kubectl drain %s --ignore-daemonsets --delete-emptydir-data --timeout=5m", hostname)); err != nil {
+		return fmt.Errorf("%s: drain: %w", n.GetHostname(), err)
+	}
+	out, err = n.Run(dir, "bash install.sh kubelet kubectl")
+	e.log.Info(string(out))
+	if err != nil {
+		return err
+	}
+	if err := e.verifyBundle(n); err != nil {
+		return err
+	}
+	if _, err := n.Run("", "sudo systemctl daemon-reload", "sudo systemctl restart kubelet"); err != nil {
+		return err
+	}
+	if _, err := e.master.Run("", fmt.Sprintf("kubectl uncordon %s", hostname)); err != nil {
+		return fmt.Errorf("%s: uncordon: %w", n.GetHostname(), err)
+	}
+	return e.runChecks(readinessCheck{
+		name: fmt.Sprintf("node %s Ready", n.GetHostname()),
+		cmd:  fmt.Sprintf("kubectl wait --for=condition=Ready node/%s --timeout=5m", hostname),
+	})
+}
+
+type upgradeState struct {
+	batch    int
+	mu       sync.Mutex
+	uploaded map[string]string
+}
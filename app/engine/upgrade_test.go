@@ -0,0 +1,257 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"k8s-tool/app/node"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// commandLog is the commands the fake nodes of a test ran, in order.
+type commandLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *commandLog) add(entry string) {
+	l.mu.Lock()
+	l.entries = append(l.entries, entry)
+	l.mu.Unlock()
+}
+
+// about returns the entries run on hostname or naming it.
+func (l *commandLog) about(hostname string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var entries []string
+	for _, entry := range l.entries {
+		if strings.HasPrefix(entry, hostname+": ") || strings.Contains(entry, "'"+hostname+"'") {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// fakeNode runs nothing: it records commands, installs, file reads and
+// writes and uploads as "hostname: command" and answers commands and reads
+// with reply.
+type fakeNode struct {
+	node.Node
+	log   *commandLog
+	reply func(hostname, cmd string) (string, error)
+}
+
+func (n *fakeNode) record(cmd string) ([]byte, error) {
+	n.log.add(n.GetHostname() + ": " + cmd)
+	if n.reply == nil {
+		return nil, nil
+	}
+	out, err := n.reply(n.GetHostname(), cmd)
+	return []byte(out), err
+}
+
+func (n *fakeNode) Connect() error { return nil }
+
+func (n *fakeNode) Close() {}
+
+func (n *fakeNode) Run(cwd string, cmds ...string) ([]byte, error) {
+	return n.record(strings.Join(cmds, " && "))
+}
+
+func (n *fakeNode) Install(name string, a ...string) error {
+	_, err := n.record(strings.Join(append([]string{"install", name}, a...), " "))
+	return err
+}
+
+func (n *fakeNode) ReadFile(path string) ([]byte, error) {
+	return n.record("read " + path)
+}
+
+func (n *fakeNode) WriteFile(path string, data []byte, perm os.FileMode) error {
+	_, err := n.record("write " + path)
+	return err
+}
+
+func (n *fakeNode) UploadResource(name string) (string, error) {
+	_, err := n.record("upload " + name)
+	return filepath.Join("resource", name), err
+}
+
+// newFakeEngine is newTestEngine with fake nodes answering with reply.
+func newFakeEngine(t *testing.T, opts []Option, reply func(hostname, cmd string) (string, error), specs ...string) (*Engine, *commandLog) {
+	t.Helper()
+	quiet := logrus.New()
+	quiet.SetOutput(io.Discard)
+	e, err := New(append([]Option{Logger(quiet)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &commandLog{}
+	for i, spec := range specs {
+		addr, roles, _ := strings.Cut(spec, ":")
+		n := &fakeNode{Node: testNode(t, addr, fmt.Sprintf("node%d", i+1), roles, nil), log: log, reply: reply}
+		if err := e.AddNode(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e, log
+}
+
+// upgradeReply answers like a cluster at version current whose nodes are
+// names and whose nodes already have the v1.28.2 bundle installed.
+func upgradeReply(current, names string) func(hostname, cmd string) (string, error) {
+	return func(hostname, cmd string) (string, error) {
+		switch {
+		case strings.Contains(cmd, "kubectl version"):
+			return `{"serverVersion":{"gitVersion":"` + current + `"}}`, nil
+		case strings.Contains(cmd, "kubectl get nodes"):
+			return names, nil
+		case strings.Contains(cmd, "kubeadm version"):
+			return "v1.28.2\n", nil
+		case strings.Contains(cmd, "kubelet --version"):
+			return "Kubernetes v1.28.2\n", nil
+		}
+		return "", nil
+	}
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	nodes := []string{"10.0.0.1:etcd,controlplane", "10.0.0.2:worker", "10.0.0.3:etcd"}
+	tests := []struct {
+		name    string
+		current string
+		target  string
+		names   string
+		wantErr string
+	}{
+		{name: "next minor", current: "v1.27.6", target: "v1.28.2", names: "node1 node2"},
+		{name: "patch", current: "v1.28.1", target: "v1.28.2", names: "node1 node2"},
+		{name: "same version", current: "v1.28.2", target: "v1.28.2", names: "node1 node2"},
+		{name: "downgrade", current: "v1.28.2", target: "v1.27.6", names: "node1 node2", wantErr: "cannot downgrade"},
+		{name: "skip minor", current: "v1.26.9", target: "v1.28.2", names: "node1 node2", wantErr: "one minor version at a time"},
+		{name: "major", current: "v1.28.2", target: "v2.0.0", names: "node1 node2", wantErr: "across major versions"},
+		{name: "node not joined", current: "v1.27.6", target: "v1.28.2", names: "node1", wantErr: "node2 is not in the cluster"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newFakeEngine(t, []Option{KubernetesVersion(tt.target)}, upgradeReply(tt.current, tt.names), nodes...)
+			err := e.checkUpgrade()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("checkUpgrade() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("checkUpgrade() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpgradeNodeOrder(t *testing.T) {
+	e, log := newFakeEngine(t, []Option{KubernetesVersion("v1.28.2")}, upgradeReply("v1.27.6", ""),
+		"10.0.0.1:etcd,controlplane", "10.0.0.2:controlplane", "10.0.0.3:worker", "10.0.0.4:etcd")
+	if err := e.upgradeFirstControlPlane(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.upgradeControlPlanes(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.upgradeWorkers(); err != nil {
+		t.Fatal(err)
+	}
+	want := func(hostname string, upgrade ...string) []string {
+		entries := []string{
+			hostname + ": upload kubeadm",
+			hostname + ": bash install.sh kubeadm",
+			hostname + ": kubeadm version -o short",
+			hostname + ": if command -v kubelet >/dev/null 2>&1; then kubelet --version; fi",
+		}
+		entries = append(entries, upgrade...)
+		return append(entries,
+			"node1: kubectl drain '"+hostname+"' --ignore-daemonsets --delete-emptydir-data --timeout=5m",
+			hostname+": bash install.sh kubelet kubectl",
+			hostname+": kubeadm version -o short",
+			hostname+": if command -v kubelet >/dev/null 2>&1; then kubelet --version; fi",
+			hostname+": sudo systemctl daemon-reload && sudo systemctl restart kubelet",
+			"node1: kubectl uncordon '"+hostname+"'",
+			"node1: kubectl wait --for=condition=Ready node/'"+hostname+"' --timeout=5m",
+		)
+	}
+	tests := []struct {
+		hostname string
+		want     []string
+	}{
+		{hostname: "node1", want: want("node1", "node1: sudo kubeadm upgrade plan v1.28.2", "node1: sudo kubeadm upgrade apply -y v1.28.2")},
+		{hostname: "node2", want: want("node2", "node2: sudo kubeadm upgrade node")},
+		{hostname: "node3", want: want("node3", "node3: sudo kubeadm upgrade node")},
+		{hostname: "node4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			got := log.about(tt.hostname)
+			if tt.hostname == "node1" {
+				// the master also runs the drains and checks of the others
+				got = slices.DeleteFunc(got, func(entry string) bool {
+					return strings.Contains(entry, "'node2'") || strings.Contains(entry, "'node3'")
+				})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("commands for %s =\n%s\nwant\n%s", tt.hostname, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestUpgradeWorkersBatch(t *testing.T) {
+	specs := []string{"10.0.0.1:etcd,controlplane"}
+	for i := 2; i <= 6; i++ {
+		specs = append(specs, fmt.Sprintf("10.0.0.%d:worker", i))
+	}
+	specs = append(specs, "10.0.0.7:controlplane,worker")
+	tests := []struct {
+		batch int
+		want  [][]string
+	}{
+		{batch: 1, want: [][]string{{"node2"}, {"node3"}, {"node4"}, {"node5"}, {"node6"}}},
+		{batch: 2, want: [][]string{{"node2", "node3"}, {"node4", "node5"}, {"node6"}}},
+		{batch: 10, want: [][]string{{"node2", "node3", "node4", "node5", "node6"}}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.batch), func(t *testing.T) {
+			e, log := newFakeEngine(t, []Option{KubernetesVersion("v1.28.2"), UpgradeBatch(tt.batch)}, upgradeReply("v1.27.6", ""), specs...)
+			if err := e.upgradeWorkers(); err != nil {
+				t.Fatal(err)
+			}
+			if got := log.about("node7"); len(got) != 0 {
+				t.Fatalf("control plane worker upgraded with the workers:\n%s", strings.Join(got, "\n"))
+			}
+			// every node of a batch is uncordoned before the next batch starts
+			index := func(entry string) int { return slices.Index(log.entries, entry) }
+			for i := 1; i < len(tt.want); i++ {
+				for _, prev := range tt.want[i-1] {
+					done := index("node1: kubectl wait --for=condition=Ready node/'" + prev + "' --timeout=5m")
+					for _, next := range tt.want[i] {
+						start := index(next + ": upload kubeadm")
+						if done < 0 || start < 0 || done > start {
+							t.Fatalf("%s started before %s was upgraded:\n%s", next, prev, strings.Join(log.entries, "\n"))
+						}
+					}
+				}
+			}
+			for _, batch := range tt.want {
+				for _, hostname := range batch {
+					if index("node1: kubectl uncordon '"+hostname+"'") < 0 {
+						t.Fatalf("%s was not upgraded", hostname)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s-tool/app/node"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var versionPattern = regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
+
+// normalizeVersion adds the leading v kubeadm prints, e.g. 1.28.2 -> v1.28.2.
+func normalizeVersion(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if !versionPattern.MatchString(v) {
+		return "", fmt.Errorf("invalid kubernetes version %q: expected v<major>.<minor>.<patch>", v)
+	}
+	return v, nil
+}
+
+// kubeadmResource is the resource kubeadm and kubelet are installed from:
+// resource/kubeadm/<version> when a bundle for the version exists, else
+// resource/kubeadm.
+func (e *Engine) kubeadmResource() string {
+	if e.kubeadm.version != "" {
+		name := filepath.Join("kubeadm", e.kubeadm.version)
+		if fi, err := os.Stat(filepath.Join("resource", name)); err == nil && fi.IsDir() {
+			return name
+		}
+	}
+	return "kubeadm"
+}
+
+// kubeadmDir is the directory of the kubeadm resource on a node.
+func (e *Engine) kubeadmDir() string {
+	return filepath.Join("resource", e.kubeadmResource())
+}
+
+// checkBundle makes sure the configured version has a resource bundle.
+func (e *Engine) checkBundle() error {
+	if !e.kubeadm.pinned {
+		return nil
+	}
+	dir := filepath.Join("resource", "kubeadm", e.kubeadm.version)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("kubernetes %s: resource bundle %s not found", e.kubeadm.version, dir)
+	}
+	return nil
+}
+
+// verifyKubeadm checks that the kubeadm installed on n is of the expected
+// version.
+func (e *Engine) verifyKubeadm(n node.Node) error {
+	if e.kubeadm.version == "" {
+		return nil
+	}
+	out, err := n.Run("", "kubeadm version -o short")
+	if err != nil {
+		return err
+	}
+	if v := strings.TrimSpace(string(out)); v != e.kubeadm.version {
+		return fmt.Errorf("%s: kubeadm is %s, want %s: check the %s bundle", n.GetAddress(), v, e.kubeadm.version, e.kubeadmResource())
+	}
+	return nil
+}
+
+// verifyBundle checks that the kubeadm and kubelet installed on n are of the
+// expected version.
+func (e *Engine) verifyBundle(n node.Node) error {
+	if err := e.verifyKubeadm(n); err != nil {
+		return err
+	}
+	if e.kubeadm.version == "" {
+		return nil
+	}
+	v, err := kubeletVersion(n)
+	if err != nil {
+		return err
+	}
+	if v != e.kubeadm.version {
+		return fmt.Errorf("%s: kubelet is %s, want %s: check the %s bundle", n.GetAddress(), v, e.kubeadm.version, e.kubeadmResource())
+	}
+	return nil
+}
+
+// kubeletVersion returns the version of kubelet on n, or "" when kubelet is
+// not installed.
+func kubeletVersion(n node.Node) (string, error) {
+	out, err := n.Run("", "if command -v kubelet >/dev/null 2>&1; then kubelet --version; fi")
+	if err != nil {
+		return "", err
+	}
+	// Kubernetes v1.28.2
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[len(fields)-1], nil
+}
+
+// clusterVersion asks the API server for its version.
+func (e *Engine) clusterVersion() (string, error) {
+	out, err := e.master.Run("", "kubectl version -o json 2>/dev/null")
+	if err != nil {
+		return "", err
+	}
+	var v struct {
+		ServerVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"serverVersion"`
+	}
+	if err := json.Unmarshal(out, &v); err != nil {
+		return "", fmt.Errorf("parse kubectl version: %w", err)
+	}
+	if v.ServerVersion.GitVersion == "" {
+		return "", fmt.Errorf("kubectl version: no server version")
+	}
+	return v.ServerVersion.GitVersion, nil
+}
+
+// checkKubeletVersions refuses new nodes whose kubelet is not of version.
+// Nodes without kubelet are skipped unless required is set.
+func (e *Engine) checkKubeletVersions(version string, required bool) error {
+	for _, n := range e.nodes {
+		if !n.IsNew() {
+			continue
+		}
+		v, err := kubeletVersion(n)
+		if err != nil {
+			return err
+		}
+		if v == "" && !required {
+			continue
+		}
+		if v != version {
+			if v == "" {
+				v = "not installed"
+			}
+			return fmt.Errorf("%s: kubelet is %s, cluster is %s", n.GetAddress(), v, version)
+		}
+	}
+	return nil
+}
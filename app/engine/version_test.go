@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "v1.28.2", want: "v1.28.2"},
+		{in: "1.28.2", want: "v1.28.2"},
+		{in: " 1.28.2\n", want: "v1.28.2"},
+		{in: "", want: ""},
+		{in: "1.28", wantErr: true},
+		{in: "v1.28.2-rc.0", wantErr: true},
+		{in: "vv1.28.2", wantErr: true},
+		{in: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := normalizeVersion(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeVersion(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("normalizeVersion(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBundle(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		resources []string
+		want      string
+		wantErr   string
+	}{
+		{name: "not pinned", want: "kubeadm"},
+		{name: "bundle", version: "1.28.2", resources: []string{"kubeadm/v1.28.2"}, want: "kubeadm/v1.28.2"},
+		{name: "missing bundle", version: "v1.28.2", resources: []string{"kubeadm/v1.27.6"}, wantErr: "kubernetes v1.28.2: resource bundle resource/kubeadm/v1.28.2 not found"},
+		{name: "missing resource dir", version: "v1.28.2", wantErr: "kubernetes v1.28.2: resource bundle resource/kubeadm/v1.28.2 not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirResources(t, tt.resources...)
+			e := newTestEngine(t, []Option{KubernetesVersion(tt.version)}, "10.0.0.1:etcd,controlplane,worker")
+			err := e.checkBundle()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("checkBundle() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.kubeadmResource(); got != tt.want {
+				t.Fatalf("kubeadmResource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckKubeletVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		kubelets map[string]string
+		required bool
+		wantErr  string
+	}{
+		{name: "match", kubelets: map[string]string{"node2": "v1.28.2", "node3": "v1.28.2"}},
+		{name: "not installed", kubelets: map[string]string{"node2": "v1.28.2"}},
+		{name: "not installed required", kubelets: map[string]string{"node2": "v1.28.2"}, required: true, wantErr: "10.0.0.3: kubelet is not installed, cluster is v1.28.2"},
+		{name: "mismatch", kubelets: map[string]string{"node2": "v1.28.2", "node3": "v1.27.6"}, wantErr: "10.0.0.3: kubelet is v1.27.6, cluster is v1.28.2"},
+		{name: "old node skipped", kubelets: map[string]string{"node1": "v1.27.6", "node2": "v1.28.2", "node3": "v1.28.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := func(hostname, cmd string) (string, error) {
+				if v, ok := tt.kubelets[hostname]; ok && strings.Contains(cmd, "kubelet --version") {
+					return "Kubernetes " + v + "\n", nil
+				}
+				return "", nil
+			}
+			e, _ := newFakeEngine(t, nil, reply, "10.0.0.1:etcd,controlplane", "10.0.0.2:worker", "10.0.0.3:worker")
+			e.nodes[0].SetIsNew(false)
+			err := e.checkKubeletVersions("v1.28.2", tt.required)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("checkKubeletVersions() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("checkKubeletVersions() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
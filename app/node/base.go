@@ -15,6 +15,11 @@ type base struct {
 	password  string
 	hostname  string
 	keyPath   string
+	labels    map[string]string
+	// applied to the Kubernetes node once it has joined
+	nodeLabels            map[string]string
+	taints                []string
+	keepControlPlaneTaint bool
 }
 
 func (b *base) GetAddress() string {
@@ -63,6 +68,22 @@ func (b *base) GetKeyPath() string {
 	return b.keyPath
 }
 
+func (b *base) GetLabels() map[string]string {
+	return b.labels
+}
+
+func (b *base) GetNodeLabels() map[string]string {
+	return b.nodeLabels
+}
+
+func (b *base) GetTaints() []string {
+	return b.taints
+}
+
+func (b *base) KeepControlPlaneTaint() bool {
+	return b.keepControlPlaneTaint
+}
+
 func (b *base) GetHostname() string {
 	return b.hostname
 }
@@ -2,7 +2,6 @@ package node
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -37,6 +36,12 @@ type (
 		GetUsername() string
 		GetPassword() string
 		GetHostname() string
+		GetLabels() map[string]string
+		GetNodeLabels() map[string]string
+		GetTaints() []string
+		KeepControlPlaneTaint() bool
+		GetOS() string
+		GetArch() string
 		SetHostname(hostname string)
 		SetIsNew(isNew bool)
 		IsNew() bool
@@ -46,7 +51,11 @@ type (
 		ReplaceHost(addr, name string) error
 		Install(name string, a ...string) error
 		InstallWithTimeout(name string, timeout time.Duration, a ...string) error
+		UploadResource(name string) (string, error)
 		ReadFile(path string) ([]byte, error)
+		WriteFile(path string, data []byte, perm os.FileMode) error
+		Upload(src, dst string) error
+		Download(src, dst string) error
 		StopService(name string) error
 		StartService(name string) error
 		Run(cwd string, cmds ...string) ([]byte, error)
@@ -56,8 +65,9 @@ type (
 		base
 		stdout io.Writer
 		stderr io.Writer
+		log    logrus.FieldLogger
 		sshcli *ssh.Client
-		os     string
+		os     osRelease
 		arch   string
 		home   string
 	}
@@ -70,6 +80,7 @@ func New(opts ...Option) (Node, error) {
 	n.username = "root"
 	n.stdout = os.Stdout
 	n.stderr = os.Stderr
+	n.log = logrus.StandardLogger()
 	n.isNew = true
 	for _, opt := range opts {
 		if err := opt(n); err != nil {
@@ -113,6 +124,16 @@ func (n *node) Connect() error {
 	return n.fetchHome()
 }
 
+// GetOS describes the os release detected by Connect.
+func (n *node) GetOS() string {
+	return n.os.String()
+}
+
+// GetArch is the machine architecture detected by Connect.
+func (n *node) GetArch() string {
+	return n.arch
+}
+
 func (n *node) Close() {
 	if n.sshcli != nil {
 		n.sshcli.Close()
@@ -135,27 +156,23 @@ func (n *node) output(cmds ...string) (string, error) {
 }
 
 func (n *node) fetchOS() error {
-	os, err := n.output("cat /etc/os-release | grep -w ID | awk -F '=' '{print $2}'")
+	content, err := n.output("cat /etc/os-release")
 	if err != nil {
 		return err
 	}
 
-	os = strings.Trim(os, "\"\n")
-	switch os {
-	case "centos", "ubuntu":
-		n.os = os
-	case "kylin":
-		if _, err := n.output("type apt 2>/dev/null"); err == nil {
-			n.os = "ubuntu"
-		} else if _, err := n.output("type yum 2>/dev/null"); err == nil {
-			n.os = "centos"
-		} else {
-			return errors.New("kylin used neither ubuntu nor centos")
+	release := parseOSRelease(content)
+	has := func(cmd string) func() bool {
+		return func() bool {
+			_, err := n.output(fmt.Sprintf("type %s 2>/dev/null", cmd))
+			return err == nil
 		}
-	default:
-		return fmt.Errorf("unsupported operation system %q", os)
 	}
-	logrus.Infof("Node %s os: %s", n.addr, n.os)
+	if err := release.resolveFamily(has("apt"), has("yum")); err != nil {
+		return err
+	}
+	n.os = release
+	n.log.Infof("Node %s os: %s", n.addr, n.os)
 	return nil
 }
 
@@ -172,7 +189,7 @@ func (n *node) fetchArch() error {
 	default:
 		return fmt.Errorf("unsupported machine architecture: %q", arch)
 	}
-	logrus.Infof("Node %s arch: %s", n.addr, n.arch)
+	n.log.Infof("Node %s arch: %s", n.addr, n.arch)
 	return nil
 }
 
@@ -183,7 +200,7 @@ func (n *node) fetchHome() error {
 	}
 
 	n.home = home
-	logrus.Infof("Node %s home: %s", n.addr, n.home)
+	n.log.Infof("Node %s home: %s", n.addr, n.home)
 	return nil
 }
 
@@ -192,14 +209,14 @@ func (n *node) AddHost(addr, name string) error {
 		"grep -q '%s' /etc/hosts || sudo sed -i '$a %s  %s' /etc/hosts",
 		shellEscape(name), shellEscape(addr), shellEscape(name))
 	info, err := n.Run("", cmd)
-	logrus.Info(string(info))
+	n.log.Info(string(info))
 	return err
 }
 
 func (n *node) RemoveHost(name string) error {
 	cmd := fmt.Sprintf("sudo sed -ie '/%s/d' /etc/hosts", shellEscape(name))
 	info, err := n.Run("", cmd)
-	logrus.Info(string(info))
+	n.log.Info(string(info))
 	return err
 }
 
@@ -208,7 +225,7 @@ func (n *node) ReplaceHost(addr, name string) error {
 		"sudo sed -i '$a %s  %s' /etc/hosts",
 		shellEscape(name), shellEscape(addr), shellEscape(name))
 	info, err := n.Run("", cmd)
-	logrus.Info(string(info))
+	n.log.Info(string(info))
 	return err
 }
 
@@ -349,13 +366,13 @@ func (n *node) run(timeout time.Duration, cwd string, cmds ...string) ([]byte, e
 
 func (n *node) StopService(name string) error {
 	info, err := n.Run("", fmt.Sprintf("sudo systemctl stop %s", name))
-	logrus.Info(string(info))
+	n.log.Info(string(info))
 	return err
 }
 
 func (n *node) StartService(name string) error {
 	info, err := n.Run("", fmt.Sprintf("sudo systemctl start %s", name))
-	logrus.Info(string(info))
+	n.log.Info(string(info))
 	return err
 }
 
@@ -367,17 +384,19 @@ func (n *node) InstallWithTimeout(name string, timeout time.Duration, a ...strin
 	return n.install(name, timeout, a...)
 }
 
-func (n *node) install(name string, timeout time.Duration, a ...string) error {
-	srcDir := filepath.Join("resource", name)
-	dstDir := filepath.Join("resource", name)
-
-	path := filepath.Join(srcDir, n.os)
-	if _, err := os.Stat(path); err == nil {
-		srcDir = filepath.Join(srcDir, n.os)
-		dstDir = filepath.Join(dstDir, n.os)
+// UploadResource copies the resource directory matching the node os and
+// returns its path on the node.
+func (n *node) UploadResource(name string) (string, error) {
+	dir := n.os.resourceDir(name)
+	if err := n.copyDir(dir, dir); err != nil {
+		return "", err
 	}
+	return dir, nil
+}
 
-	if err := n.copyDir(srcDir, dstDir); err != nil {
+func (n *node) install(name string, timeout time.Duration, a ...string) error {
+	dstDir, err := n.UploadResource(name)
+	if err != nil {
 		return err
 	}
 
@@ -389,7 +408,7 @@ func (n *node) install(name string, timeout time.Duration, a ...string) error {
 		"chmod +x install.sh",
 		fmt.Sprintf("bash install.sh %s", strings.Join(quoted, " ")),
 	)
-	logrus.Info(string(info))
+	n.log.Info(string(info))
 	return err
 }
 
@@ -400,12 +419,7 @@ func (n *node) ReadFile(path string) ([]byte, error) {
 	}
 	defer sftp.Close()
 
-	if !strings.HasPrefix(path, "~") {
-		path = filepath.Join("resource", path)
-	} else {
-		path = strings.Replace(path, "~", n.home, 1)
-	}
-
+	path = n.remotePath(path)
 	file, err := sftp.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("open %q %s", path, err)
@@ -417,3 +431,150 @@ func (n *node) ReadFile(path string) ([]byte, error) {
 	}
 	return buf, nil
 }
+
+// WriteFile writes data to path on the node, creating parent directories.
+// path is resolved like ReadFile.
+func (n *node) WriteFile(path string, data []byte, perm os.FileMode) error {
+	sftp, err := sftp.NewClient(n.sshcli, sftp.MaxPacket(sftpMaxPacket))
+	if err != nil {
+		return err
+	}
+	defer sftp.Close()
+
+	path = n.remotePath(path)
+	if err := sftp.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	file, err := sftp.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("create %q %s", path, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Upload copies the local file or directory src to dst on the node,
+// creating parent directories. dst is resolved like ReadFile.
+func (n *node) Upload(src, dst string) error {
+	sftp, err := sftp.NewClient(n.sshcli, sftp.MaxPacket(sftpMaxPacket))
+	if err != nil {
+		return err
+	}
+	defer sftp.Close()
+
+	dst = n.remotePath(dst)
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		if err := sftp.MkdirAll(filepath.Dir(dst)); err != nil {
+			return err
+		}
+		return n.copyFile(src, dst)
+	}
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.ToSlash(filepath.Join(dst, rel))
+		if d.IsDir() {
+			return sftp.MkdirAll(target)
+		}
+		return n.copyFile(path, target)
+	})
+}
+
+// Download copies the file or directory src on the node to dst. src is
+// resolved like ReadFile.
+func (n *node) Download(src, dst string) error {
+	sftp, err := sftp.NewClient(n.sshcli, sftp.MaxPacket(sftpMaxPacket))
+	if err != nil {
+		return err
+	}
+	defer sftp.Close()
+
+	src = n.remotePath(src)
+	fi, err := sftp.Stat(src)
+	if err != nil {
+		return fmt.Errorf("stat %q %s", src, err)
+	}
+	if !fi.IsDir() {
+		return n.downloadFile(sftp, src, dst)
+	}
+	walker := sftp.Walk(src)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, walker.Path())
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case walker.Stat().IsDir():
+			err = os.MkdirAll(target, 0o755)
+		case walker.Stat().Mode().IsRegular():
+			err = n.downloadFile(sftp, walker.Path(), target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *node) downloadFile(client *sftp.Client, src, dst string) error {
+	srcFile, err := client.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %q %s", src, err)
+	}
+	defer srcFile.Close()
+	fi, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	bar := pb.New64(fi.Size())
+	bar.Output = n.stdout
+	bar.Prefix(dst).Start()
+	_, err = io.Copy(io.MultiWriter(dstFile, bar), srcFile)
+	bar.Finish()
+	if err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// remotePath resolves "~" to the home directory and relative paths to the
+// resource directory. Absolute paths are used as is.
+func (n *node) remotePath(path string) string {
+	switch {
+	case strings.HasPrefix(path, "~"):
+		return strings.Replace(path, "~", n.home, 1)
+	case filepath.IsAbs(path):
+		return path
+	}
+	return filepath.Join("resource", path)
+}
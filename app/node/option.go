@@ -3,8 +3,12 @@ package node
 import (
 	"encoding/base64"
 	"fmt"
+	"io"
 	"net"
+	"regexp"
 	"strings"
+
+	"github.com/sirupsen/logrus"
 )
 
 type Option func(n *node) error
@@ -74,3 +78,89 @@ func KeyPath(keyPath string) Option {
 		return nil
 	}
 }
+
+// Labels sets free-form labels used to select the node, keys are
+// compared case-insensitively.
+func Labels(labels map[string]string) Option {
+	return func(n *node) error {
+		n.labels = make(map[string]string, len(labels))
+		for k, v := range labels {
+			n.labels[strings.ToLower(k)] = v
+		}
+		return nil
+	}
+}
+
+var (
+	// [prefix/]name as accepted by kubectl label and kubectl taint
+	labelKeyPattern   = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?[A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// NodeLabels sets the labels put on the Kubernetes node after it joined.
+func NodeLabels(labels map[string]string) Option {
+	return func(n *node) error {
+		for k, v := range labels {
+			if !labelKeyPattern.MatchString(k) {
+				return fmt.Errorf("invalid node label key: %s", k)
+			}
+			if !labelValuePattern.MatchString(v) {
+				return fmt.Errorf("invalid value of node label %s: %s", k, v)
+			}
+		}
+		n.nodeLabels = labels
+		return nil
+	}
+}
+
+// Taints sets the taints put on the Kubernetes node after it joined, in the
+// kubectl format key[=value]:effect.
+func Taints(taints []string) Option {
+	return func(n *node) error {
+		for _, t := range taints {
+			kv, effect, ok := strings.Cut(t, ":")
+			switch {
+			case !ok:
+				return fmt.Errorf("invalid taint %s: missing effect", t)
+			case effect != "NoSchedule" && effect != "PreferNoSchedule" && effect != "NoExecute":
+				return fmt.Errorf("invalid taint %s: effect must be NoSchedule, PreferNoSchedule or NoExecute", t)
+			}
+			key, value, _ := strings.Cut(kv, "=")
+			if !labelKeyPattern.MatchString(key) || !labelValuePattern.MatchString(value) {
+				return fmt.Errorf("invalid taint %s", t)
+			}
+		}
+		n.taints = taints
+		return nil
+	}
+}
+
+// KeepControlPlaneTaint leaves the control-plane taint kubeadm puts on a
+// control plane, so only tolerating workloads are scheduled on it.
+func KeepControlPlaneTaint(keep bool) Option {
+	return func(n *node) error {
+		n.keepControlPlaneTaint = keep
+		return nil
+	}
+}
+
+func Output(stdout, stderr io.Writer) Option {
+	return func(n *node) error {
+		if stdout != nil {
+			n.stdout = stdout
+		}
+		if stderr != nil {
+			n.stderr = stderr
+		}
+		return nil
+	}
+}
+
+func Logger(log logrus.FieldLogger) Option {
+	return func(n *node) error {
+		if log != nil {
+			n.log = log
+		}
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package node
+
+import "testing"
+
+func TestTaints(t *testing.T) {
+	tests := []struct {
+		name    string
+		taint   string
+		wantErr bool
+	}{
+		{name: "key and value", taint: "dedicated=infra:NoSchedule"},
+		{name: "key only", taint: "node-role.kubernetes.io/control-plane:NoSchedule"},
+		{name: "prefer", taint: "gpu=true:PreferNoSchedule"},
+		{name: "no effect", taint: "dedicated=infra", wantErr: true},
+		{name: "bad effect", taint: "dedicated=infra:Never", wantErr: true},
+		{name: "bad key", taint: "-dedicated:NoExecute", wantErr: true},
+		{name: "bad value", taint: "dedicated=a b:NoExecute", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(Taints([]string{tt.taint}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Taints(%q) error = %v, wantErr %v", tt.taint, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodeLabels(t *testing.T) {
+	if _, err := New(NodeLabels(map[string]string{"topology.kubernetes.io/zone": "zone-a", "gpu": ""})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(NodeLabels(map[string]string{"a/b/c": "x"})); err == nil {
+		t.Fatal("want error for key with two prefixes")
+	}
+}
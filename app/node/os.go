@@ -0,0 +1,171 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	familyRHEL   = "rhel"
+	familyDebian = "debian"
+)
+
+// legacyOS is the resource directory used before distro families existed.
+var legacyOS = map[string]string{
+	familyRHEL:   "centos",
+	familyDebian: "ubuntu",
+}
+
+type distro struct {
+	family     string
+	minVersion string
+}
+
+// distros lists the supported distributions by os-release ID. An empty
+// family is decided by the package manager found on the node.
+var distros = map[string]distro{
+	"centos":    {family: familyRHEL, minVersion: "7"},
+	"rhel":      {family: familyRHEL, minVersion: "7"},
+	"rocky":     {family: familyRHEL, minVersion: "8"},
+	"almalinux": {family: familyRHEL, minVersion: "8"},
+	"anolis":    {family: familyRHEL, minVersion: "7"},
+	"openeuler": {family: familyRHEL, minVersion: "20.03"},
+	"ubuntu":    {family: familyDebian, minVersion: "18.04"},
+	"debian":    {family: familyDebian, minVersion: "10"},
+	"uos":       {family: familyDebian, minVersion: "20"},
+	"kylin":     {},
+}
+
+type osRelease struct {
+	id      string
+	idLike  []string
+	version string
+	family  string
+}
+
+func (r osRelease) String() string {
+	return fmt.Sprintf("%s %s (%s)", r.id, r.version, r.family)
+}
+
+func parseOSRelease(content string) osRelease {
+	var r osRelease
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			r.id = strings.ToLower(value)
+		case "ID_LIKE":
+			r.idLike = strings.Fields(strings.ToLower(value))
+		case "VERSION_ID":
+			r.version = value
+		}
+	}
+	return r
+}
+
+// resolveFamily fills in the family of r. hasApt/hasYum are only consulted
+// for distributions that ship either package manager.
+func (r *osRelease) resolveFamily(hasApt, hasYum func() bool) error {
+	d, ok := distros[r.id]
+	if !ok {
+		for _, like := range r.idLike {
+			if ld, found := distros[like]; found && ld.family != "" {
+				d = distro{family: ld.family}
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unsupported operation system %q", r.id)
+		}
+	}
+	if d.family == "" {
+		switch {
+		case hasApt():
+			d.family = familyDebian
+		case hasYum():
+			d.family = familyRHEL
+		default:
+			return fmt.Errorf("%s used neither apt nor yum", r.id)
+		}
+	}
+	if d.minVersion != "" && compareVersion(r.version, d.minVersion) < 0 {
+		return fmt.Errorf("unsupported operation system %s %s: need %s or later", r.id, r.version, d.minVersion)
+	}
+	r.family = d.family
+	return nil
+}
+
+// compareVersion compares dotted numeric versions. Versions that are not
+// numeric (e.g. kylin's V10) compare as equal.
+func compareVersion(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		var err error
+		if i < len(as) {
+			if x, err = strconv.Atoi(as[i]); err != nil {
+				return 0
+			}
+		}
+		if i < len(bs) {
+			if y, err = strconv.Atoi(bs[i]); err != nil {
+				return 0
+			}
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// resourceDirs lists the candidate sub directories of a resource, most
+// specific first.
+func (r osRelease) resourceDirs() []string {
+	var dirs []string
+	add := func(parts ...string) {
+		for _, p := range parts {
+			if p == "" {
+				return
+			}
+		}
+		dir := filepath.Join(parts...)
+		for _, d := range dirs {
+			if d == dir {
+				return
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	major, _, _ := strings.Cut(r.version, ".")
+	for _, name := range []string{r.id, r.family} {
+		add(name, r.version)
+		add(name, major)
+		add(name)
+	}
+	add(legacyOS[r.family])
+	return dirs
+}
+
+// resourceDir returns the resource directory to install from for name.
+func (r osRelease) resourceDir(name string) string {
+	base := filepath.Join("resource", name)
+	for _, dir := range r.resourceDirs() {
+		path := filepath.Join(base, dir)
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			return path
+		}
+	}
+	return base
+}
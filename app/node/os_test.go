@@ -0,0 +1,75 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveFamily(t *testing.T) {
+	no := func() bool { return false }
+	yes := func() bool { return true }
+	tests := []struct {
+		name    string
+		release string
+		hasApt  func() bool
+		family  string
+		wantErr bool
+	}{
+		{name: "rocky", release: "ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"9.3\"\n", family: familyRHEL},
+		{name: "openEuler", release: "ID=\"openEuler\"\nVERSION_ID=\"22.03\"\n", family: familyRHEL},
+		{name: "uos", release: "ID=uos\nVERSION_ID=\"20\"\n", family: familyDebian},
+		{name: "id like", release: "ID=linuxmint\nID_LIKE=\"ubuntu debian\"\nVERSION_ID=21\n", family: familyDebian},
+		{name: "kylin apt", release: "ID=kylin\nVERSION_ID=\"V10\"\n", hasApt: yes, family: familyDebian},
+		{name: "kylin yum", release: "ID=kylin\nVERSION_ID=\"V10\"\n", family: familyRHEL},
+		{name: "too old", release: "ID=centos\nVERSION_ID=\"6\"\n", wantErr: true},
+		{name: "unknown", release: "ID=arch\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := parseOSRelease(tt.release)
+			hasApt := tt.hasApt
+			if hasApt == nil {
+				hasApt = no
+			}
+			err := r.resolveFamily(hasApt, yes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveFamily() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && r.family != tt.family {
+				t.Fatalf("family = %q, want %q", r.family, tt.family)
+			}
+		})
+	}
+}
+
+func TestResourceDir(t *testing.T) {
+	r := osRelease{id: "rocky", version: "9.3", family: familyRHEL}
+	want := []string{"rocky/9.3", "rocky/9", "rocky", "rhel/9.3", "rhel/9", "rhel", "centos"}
+	if got := r.resourceDirs(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resourceDirs() = %v, want %v", got, want)
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, d := range []string{"resource/docker/centos", "resource/docker/rhel/9"} {
+		if err := os.MkdirAll(filepath.FromSlash(d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := r.resourceDir("docker"); got != filepath.Join("resource", "docker", "rhel", "9") {
+		t.Fatalf("resourceDir() = %q", got)
+	}
+	if got := r.resourceDir("helm"); got != filepath.Join("resource", "helm") {
+		t.Fatalf("resourceDir() = %q", got)
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type role int
+
+const (
+	roleViewer role = iota + 1
+	roleOperator
+	roleAdmin
+)
+
+func parseRole(s string) (role, error) {
+	switch strings.ToLower(s) {
+	case "viewer":
+		return roleViewer, nil
+	case "operator":
+		return roleOperator, nil
+	case "admin":
+		return roleAdmin, nil
+	default:
+		return 0, fmt.Errorf("invalid role: %s", s)
+	}
+}
+
+func (r role) String() string {
+	switch r {
+	case roleViewer:
+		return "viewer"
+	case roleOperator:
+		return "operator"
+	case roleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+type principal struct {
+	Name string
+	Role role
+}
+
+type userConfig struct {
+	Name     string `mapstructure:"name" yaml:"name" json:"name"`
+	Password string `mapstructure:"password" yaml:"password" json:"password"`
+	Role     string `mapstructure:"role" yaml:"role" json:"role"`
+}
+
+type tokenConfig struct {
+	Name  string `mapstructure:"name" yaml:"name" json:"name"`
+	Token string `mapstructure:"token" yaml:"token" json:"token"`
+	Role  string `mapstructure:"role" yaml:"role" json:"role"`
+}
+
+type authConfig struct {
+	Users  []*userConfig  `mapstructure:"users" yaml:"users" json:"users"`
+	Tokens []*tokenConfig `mapstructure:"tokens" yaml:"tokens" json:"tokens"`
+}
+
+type user struct {
+	hash []byte
+	role role
+}
+
+type token struct {
+	name  string
+	token []byte
+	role  role
+}
+
+// Auth authenticates API requests with basic auth against bcrypt'd user
+// passwords or with bearer tokens.
+type Auth struct {
+	users  map[string]user
+	tokens []token
+
+	// verified holds, per user, a digest of the password that last passed
+	// bcrypt, so it never grows beyond the configured users
+	mu       sync.Mutex
+	verified map[string][sha256.Size]byte
+}
+
+// LoadAuth reads users and tokens from the file at path.
+func LoadAuth(path string) (*Auth, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var c authConfig
+	if err := v.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+
+	a := &Auth{users: make(map[string]user), verified: make(map[string][sha256.Size]byte)}
+	for _, u := range c.Users {
+		r, err := parseRole(u.Role)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Name, err)
+		}
+		if _, err := bcrypt.Cost([]byte(u.Password)); err != nil {
+			return nil, fmt.Errorf("user %s: password must be a bcrypt hash: %w", u.Name, err)
+		}
+		a.users[u.Name] = user{hash: []byte(u.Password), role: r}
+	}
+	for _, t := range c.Tokens {
+		r, err := parseRole(t.Role)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %w", t.Name, err)
+		}
+		if len(t.Token) < 16 {
+			return nil, fmt.Errorf("token %s: must be at least 16 characters", t.Name)
+		}
+		a.tokens = append(a.tokens, token{name: t.Name, token: []byte(t.Token), role: r})
+	}
+	if len(a.users) == 0 && len(a.tokens) == 0 {
+		return nil, errors.New("auth config has neither users nor tokens")
+	}
+	return a, nil
+}
+
+// HashPassword returns the bcrypt hash to put in the auth config.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func (a *Auth) authenticate(r *http.Request) (principal, bool) {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		got := []byte(strings.TrimPrefix(h, "Bearer "))
+		for _, t := range a.tokens {
+			if subtle.ConstantTimeCompare(got, t.token) == 1 {
+				return principal{Name: "token:" + t.name, Role: t.role}, true
+			}
+		}
+		return principal{}, false
+	}
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return principal{}, false
+	}
+	u, ok := a.users[name]
+	if !ok {
+		return principal{}, false
+	}
+	// bcrypt 较慢，按用户缓存最近一次校验通过的密码摘要
+	digest := sha256.Sum256([]byte(password + "\x00" + string(u.hash)))
+	a.mu.Lock()
+	last, cached := a.verified[name]
+	a.mu.Unlock()
+	if !cached || subtle.ConstantTimeCompare(last[:], digest[:]) != 1 {
+		if err := bcrypt.CompareHashAndPassword(u.hash, []byte(password)); err != nil {
+			return principal{}, false
+		}
+		a.mu.Lock()
+		a.verified[name] = digest
+		a.mu.Unlock()
+	}
+	return principal{Name: name, Role: u.role}, true
+}
+
+type principalKey struct{}
+
+func principalFrom(ctx context.Context) principal {
+	p, _ := ctx.Value(principalKey{}).(principal)
+	return p
+}
+
+// require wraps h so that it only runs for callers holding at least min.
+func (s *Server) require(min role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := principal{Name: "anonymous", Role: roleAdmin}
+		if s.auth != nil {
+			var ok bool
+			p, ok = s.auth.authenticate(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="k8s-tool"`)
+				writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+				return
+			}
+		}
+		if p.Role < min {
+			writeError(w, http.StatusForbidden, fmt.Errorf("%s role required", min))
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// actionRole is the role needed to start a job running action.
+func actionRole(action string) role {
+	if action == "reset" || action == "upgrade" {
+		return roleAdmin
+	}
+	return roleOperator
+}
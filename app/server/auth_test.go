@@ -0,0 +1,239 @@
+package server
+
+import (
+	"k8s-tool/app/config"
+	"k8s-tool/app/store"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeAuthConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "auth.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestServer serves a store holding the cluster prod, on which a job is
+// already running so that job requests passing every check end in a
+// conflict instead of starting a deployment.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadAuth(writeAuthConfig(t, `users:
+  - name: viewer
+    password: `+hash+`
+    role: viewer
+  - name: operator
+    password: `+hash+`
+    role: operator
+  - name: admin
+    password: `+hash+`
+    role: Admin
+tokens:
+  - name: ci
+    token: 0123456789abcdef
+    role: operator
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.Open(filepath.Join(t.TempDir(), "k8s-tool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	if err := st.PutCluster(&store.Cluster{Name: "prod", Config: &config.Config{}, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Store(st), WithAuth(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.jobs["job-running"] = &job{Job: store.Job{ID: "job-running", Cluster: "prod", Status: jobRunning}}
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    role
+		wantErr bool
+	}{
+		{in: "viewer", want: roleViewer},
+		{in: "operator", want: roleOperator},
+		{in: "Admin", want: roleAdmin},
+		{in: "", wantErr: true},
+		{in: "root", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseRole(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRole() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("parseRole() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionRole(t *testing.T) {
+	tests := []struct {
+		action string
+		want   role
+	}{
+		{action: "install", want: roleOperator},
+		{action: "update", want: roleOperator},
+		{action: "reset", want: roleAdmin},
+		{action: "upgrade", want: roleAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			if got := actionRole(tt.action); got != tt.want {
+				t.Fatalf("actionRole() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadAuthErrors(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "empty", content: "users: []\n"},
+		{name: "invalid role", content: "users:\n  - name: a\n    password: " + hash + "\n    role: root\n"},
+		{name: "plain password", content: "users:\n  - name: a\n    password: secret\n    role: admin\n"},
+		{name: "short token", content: "tokens:\n  - name: ci\n    token: short\n    role: admin\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadAuth(writeAuthConfig(t, tt.content)); err == nil {
+				t.Fatal("LoadAuth() error = nil")
+			}
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		token    string
+		method   string
+		path     string
+		body     string
+		want     int
+	}{
+		{name: "anonymous", method: "GET", path: "/api/jobs", want: http.StatusUnauthorized},
+		{name: "wrong password", user: "admin", password: "wrong", method: "GET", path: "/api/jobs", want: http.StatusUnauthorized},
+		{name: "unknown user", user: "nobody", password: "secret", method: "GET", path: "/api/jobs", want: http.StatusUnauthorized},
+		{name: "wrong token", token: "fedcba9876543210", method: "GET", path: "/api/jobs", want: http.StatusUnauthorized},
+
+		{name: "viewer lists jobs", user: "viewer", method: "GET", path: "/api/jobs", want: http.StatusOK},
+		{name: "viewer lists clusters", user: "viewer", method: "GET", path: "/api/clusters", want: http.StatusOK},
+		{name: "viewer reads cluster", user: "viewer", method: "GET", path: "/api/clusters/prod", want: http.StatusForbidden},
+		{name: "viewer starts job", user: "viewer", method: "POST", path: "/api/clusters/prod/jobs", body: `{"action":"install"}`, want: http.StatusForbidden},
+		{name: "viewer starts job by cluster", user: "viewer", method: "POST", path: "/api/jobs", body: `{"cluster":"prod"}`, want: http.StatusForbidden},
+
+		{name: "operator reads cluster", user: "operator", method: "GET", path: "/api/clusters/prod", want: http.StatusOK},
+		{name: "operator installs", user: "operator", method: "POST", path: "/api/clusters/prod/jobs", body: `{"action":"install"}`, want: http.StatusConflict},
+		{name: "operator updates by cluster", user: "operator", method: "POST", path: "/api/jobs", body: `{"cluster":"prod","action":"update"}`, want: http.StatusConflict},
+		{name: "operator resets", user: "operator", method: "POST", path: "/api/clusters/prod/jobs", body: `{"action":"reset"}`, want: http.StatusForbidden},
+		{name: "operator upgrades", user: "operator", method: "POST", path: "/api/jobs", body: `{"cluster":"prod","action":"upgrade"}`, want: http.StatusForbidden},
+		{name: "operator deletes cluster", user: "operator", method: "DELETE", path: "/api/clusters/prod", want: http.StatusForbidden},
+		{name: "operator reads audit", user: "operator", method: "GET", path: "/api/audit", want: http.StatusForbidden},
+		{name: "token installs", token: "0123456789abcdef", method: "POST", path: "/api/clusters/prod/jobs", body: `{"action":"install"}`, want: http.StatusConflict},
+		{name: "token resets", token: "0123456789abcdef", method: "POST", path: "/api/clusters/prod/jobs", body: `{"action":"reset"}`, want: http.StatusForbidden},
+
+		{name: "admin resets", user: "admin", method: "POST", path: "/api/clusters/prod/jobs", body: `{"action":"reset"}`, want: http.StatusConflict},
+		{name: "admin upgrades", user: "admin", method: "POST", path: "/api/jobs", body: `{"cluster":"prod","action":"upgrade"}`, want: http.StatusConflict},
+		{name: "admin reads audit", user: "admin", method: "GET", path: "/api/audit", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.token != "":
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			case tt.user != "":
+				password := tt.password
+				if password == "" {
+					password = "secret"
+				}
+				req.SetBasicAuth(tt.user, password)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("%s %s as %q = %d, want %d", tt.method, tt.path, tt.user+tt.token, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateCache(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadAuth(writeAuthConfig(t, "users:\n"+
+		"  - {name: alice, password: '"+hash+"', role: admin}\n"+
+		"  - {name: bob, password: '"+hash+"', role: viewer}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cache keeps one entry per user whatever is presented
+	tests := []struct {
+		user     string
+		password string
+		want     bool
+		cached   int
+	}{
+		{user: "alice", password: "wrong", want: false, cached: 0},
+		{user: "alice", password: "secret", want: true, cached: 1},
+		{user: "alice", password: "secret", want: true, cached: 1},
+		{user: "alice", password: "secret2", want: false, cached: 1},
+		{user: "alice", password: "wrong", want: false, cached: 1},
+		{user: "mallory", password: "secret", want: false, cached: 1},
+		{user: "bob", password: "secret", want: true, cached: 2},
+		{user: "alice", password: "secret", want: true, cached: 2},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/jobs", nil)
+		req.SetBasicAuth(tt.user, tt.password)
+		p, ok := a.authenticate(req)
+		if ok != tt.want || (ok && p.Name != tt.user) {
+			t.Fatalf("step %d: authenticate(%s, %s) = %v, %v, want %v", i, tt.user, tt.password, p, ok, tt.want)
+		}
+		if len(a.verified) != tt.cached {
+			t.Fatalf("step %d: %d cached users, want %d", i, len(a.verified), tt.cached)
+		}
+	}
+}
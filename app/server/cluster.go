@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"k8s-tool/app/store"
+	"net/http"
+	"slices"
+	"time"
+)
+
+func (s *Server) listClusters(w http.ResponseWriter, r *http.Request) {
+	clusters, err := s.store.ListClusters()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// 清单含节点凭据，只在详情中返回
+	for _, c := range clusters {
+		c.Config = nil
+	}
+	writeJSON(w, http.StatusOK, clusters)
+}
+
+func (s *Server) getCluster(w http.ResponseWriter, r *http.Request) {
+	c, err := s.store.GetCluster(r.PathValue("name"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// putCluster stores the inventory of a cluster, keeping what earlier runs
+// recorded about it.
+func (s *Server) putCluster(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	cfg, err := readConfig(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateConfig(cfg); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	now := time.Now()
+	c, err := s.store.GetCluster(name)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		c = &store.Cluster{Name: name, CreatedAt: now}
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	c.Config = cfg
+	c.UpdatedAt = now
+	if err := s.store.PutCluster(c); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.audit(r, "cluster.put", name, "", "")
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) deleteCluster(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := s.store.DeleteCluster(name); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.audit(r, "cluster.delete", name, "", "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listClusterJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.store.ListJobs(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) createClusterJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req.Cluster = r.PathValue("name")
+	s.startClusterJob(w, r, req)
+}
+
+// startClusterJob runs the job against the stored inventory of req.Cluster.
+func (s *Server) startClusterJob(w http.ResponseWriter, r *http.Request, req jobRequest) {
+	c, err := s.store.GetCluster(req.Cluster)
+	if err != nil {
+		writeStoreError(w, fmt.Errorf("cluster %s: %w", req.Cluster, err))
+		return
+	}
+	req.Config = ""
+	s.startJob(w, r, req, c.Config)
+}
+
+// recordClusterRun updates the version and components of the cluster the
+// job ran against.
+func (s *Server) recordClusterRun(j *store.Job) error {
+	c, err := s.store.GetCluster(j.Cluster)
+	if err != nil {
+		return err
+	}
+	c.LastJob = j.ID
+	c.UpdatedAt = time.Now()
+	switch {
+	case j.Action == "reset" && j.Status == jobSucceeded:
+		c.KubernetesVersion = ""
+		c.Components = nil
+	case j.Action != "reset" && j.Report != nil:
+		if j.Report.KubernetesVersion != "" {
+			c.KubernetesVersion = j.Report.KubernetesVersion
+		}
+		for _, comp := range j.Report.Components {
+			if !slices.Contains(c.Components, comp) {
+				c.Components = append(c.Components, comp)
+			}
+		}
+	}
+	return s.store.PutCluster(c)
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"k8s-tool/app/engine"
+	"k8s-tool/app/store"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jobPending   = "pending"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+const (
+	eventStep   = "step"
+	eventLog    = "log"
+	eventResult = "result"
+)
+
+const (
+	// maxJobEvents bounds the history replayed to late subscribers.
+	maxJobEvents     = 20000
+	subscriberBuffer = 256
+)
+
+type event struct {
+	ID     int       `json:"id"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Node   string    `json:"node,omitempty"`
+	Stream string    `json:"stream,omitempty"`
+	Data   string    `json:"data,omitempty"`
+	Status string    `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type job struct {
+	store.Job
+
+	mu     sync.Mutex
+	seq    int
+	events []event
+	subs   map[chan event]struct{}
+}
+
+// restoreJob rebuilds a finished job from its stored record and events.
+func restoreJob(sj *store.Job, data []byte) (*job, error) {
+	j := &job{Job: *sj}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &j.events); err != nil {
+			return nil, err
+		}
+	}
+	if n := len(j.events); n > 0 {
+		j.seq = j.events[n-1].ID
+	}
+	return j, nil
+}
+
+type jobWriter struct {
+	j      *job
+	node   string
+	stream string
+}
+
+func (w *jobWriter) Write(p []byte) (int, error) {
+	w.j.emit(event{Type: eventLog, Node: w.node, Stream: w.stream, Data: string(p)})
+	return len(p), nil
+}
+
+// writer returns an io.Writer turning everything written into log events
+// tagged with node and stream.
+func (j *job) writer(node, stream string) io.Writer {
+	return &jobWriter{j: j, node: node, stream: stream}
+}
+
+func (j *job) emit(ev event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.emitLocked(ev)
+}
+
+func (j *job) emitLocked(ev event) {
+	j.seq++
+	ev.ID = j.seq
+	ev.Time = time.Now()
+	j.events = append(j.events, ev)
+	if len(j.events) > maxJobEvents {
+		j.events = j.events[len(j.events)-maxJobEvents:]
+	}
+	for ch := range j.subs {
+		select {
+		case ch <- ev:
+		default:
+			// 订阅方跟不上，断开后由客户端带 Last-Event-ID 重连补齐
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the buffered events after the given id and, while the
+// job is still active, a channel delivering the following ones. The channel
+// is closed once the result event was sent.
+func (j *job) subscribe(after int) ([]event, <-chan event, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var history []event
+	for _, ev := range j.events {
+		if ev.ID > after {
+			history = append(history, ev)
+		}
+	}
+	if !j.activeLocked() {
+		return history, nil, func() {}
+	}
+	ch := make(chan event, subscriberBuffer)
+	if j.subs == nil {
+		j.subs = make(map[chan event]struct{})
+	}
+	j.subs[ch] = struct{}{}
+	return history, ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subs[ch]; ok {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (j *job) logs() []byte {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var b strings.Builder
+	for _, ev := range j.events {
+		switch ev.Type {
+		case eventStep:
+			b.WriteString("==> " + ev.Data + "\n")
+		case eventLog:
+			b.WriteString(ev.Data)
+		}
+	}
+	return []byte(b.String())
+}
+
+func (j *job) setStep(name string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Step = name
+	j.emitLocked(event{Type: eventStep, Data: name})
+}
+
+func (j *job) start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Status = jobRunning
+	j.StartedAt = time.Now()
+}
+
+func (j *job) finish(err error, report engine.Report) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.FinishedAt = time.Now()
+	j.Report = &report
+	j.Status = jobSucceeded
+	if err != nil {
+		j.Status = jobFailed
+		j.Error = err.Error()
+	}
+	j.emitLocked(event{Type: eventResult, Status: j.Status, Error: j.Error})
+	for ch := range j.subs {
+		close(ch)
+	}
+	j.subs = nil
+}
+
+func (j *job) active() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.activeLocked()
+}
+
+func (j *job) activeLocked() bool {
+	return j.Status == jobPending || j.Status == jobRunning
+}
+
+// snapshot returns a copy that is safe to encode while the job is running.
+func (j *job) snapshot() *store.Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	sj := j.Job
+	return &sj
+}
+
+func (j *job) marshalEvents() ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return json.Marshal(j.events)
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"k8s-tool/app/engine"
+	"k8s-tool/app/store"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func eventIDs(events []event) []int {
+	var ids []int
+	for _, ev := range events {
+		ids = append(ids, ev.ID)
+	}
+	return ids
+}
+
+func newRunningJob(logs int) *job {
+	j := &job{Job: store.Job{ID: "job-1", Status: jobRunning}}
+	for i := 0; i < logs; i++ {
+		fmt.Fprintf(j.writer("10.0.0.1", "stdout"), "line %d\n", i+1)
+	}
+	return j
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	tests := []struct {
+		name  string
+		after int
+		want  []int
+	}{
+		{name: "from start", after: 0, want: []int{1, 2, 3, 4, 5}},
+		{name: "after last seen", after: 3, want: []int{4, 5}},
+		{name: "up to date", after: 5},
+		{name: "ahead", after: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newRunningJob(5)
+			history, ch, cancel := j.subscribe(tt.after)
+			defer cancel()
+			if got := eventIDs(history); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("subscribe(%d) history = %v, want %v", tt.after, got, tt.want)
+			}
+			j.setStep("install")
+			if ev := <-ch; ev.ID != 6 || ev.Type != eventStep {
+				t.Fatalf("subscribe(%d) next event = %+v, want step 6", tt.after, ev)
+			}
+			j.finish(errors.New("boom"), engine.Report{})
+			if ev := <-ch; ev.Type != eventResult || ev.Status != jobFailed {
+				t.Fatalf("subscribe(%d) last event = %+v, want failed result", tt.after, ev)
+			}
+			if _, ok := <-ch; ok {
+				t.Fatal("channel still open after the result")
+			}
+		})
+	}
+}
+
+func TestSubscribeFinished(t *testing.T) {
+	j := newRunningJob(2)
+	j.finish(nil, engine.Report{})
+	history, ch, cancel := j.subscribe(1)
+	defer cancel()
+	if ch != nil {
+		t.Fatal("subscribe() on a finished job returned a channel")
+	}
+	if got := eventIDs(history); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Fatalf("subscribe() history = %v, want [2 3]", got)
+	}
+}
+
+func TestEmitBufferCap(t *testing.T) {
+	j := newRunningJob(maxJobEvents + 10)
+	if len(j.events) != maxJobEvents {
+		t.Fatalf("job keeps %d events, want %d", len(j.events), maxJobEvents)
+	}
+	if first, last := j.events[0].ID, j.events[len(j.events)-1].ID; first != 11 || last != maxJobEvents+10 {
+		t.Fatalf("job keeps events %d-%d, want 11-%d", first, last, maxJobEvents+10)
+	}
+	history, _, cancel := j.subscribe(0)
+	defer cancel()
+	if len(history) != maxJobEvents || history[0].ID != 11 {
+		t.Fatalf("replay from 0 starts at %d with %d events", history[0].ID, len(history))
+	}
+}
+
+func TestEmitDropsSlowSubscriber(t *testing.T) {
+	j := newRunningJob(0)
+	_, slow, cancelSlow := j.subscribe(0)
+	defer cancelSlow()
+	_, fast, cancelFast := j.subscribe(0)
+	defer cancelFast()
+
+	emit := func(n int) {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < n; i++ {
+				j.emit(event{Type: eventLog, Data: "line\n"})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("emit blocked on a subscriber that does not read")
+		}
+	}
+	// both buffers fill up, only the fast subscriber drains its own
+	emit(subscriberBuffer)
+	for i := 0; i < subscriberBuffer; i++ {
+		<-fast
+	}
+	emit(1)
+
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("slow subscriber got %d events before being dropped, want %d", n, subscriberBuffer)
+	}
+	if ev := <-fast; ev.ID != subscriberBuffer+1 {
+		t.Fatalf("fast subscriber got event %d, want %d", ev.ID, subscriberBuffer+1)
+	}
+	if len(j.subs) != 1 {
+		t.Fatalf("job has %d subscribers, want 1", len(j.subs))
+	}
+}
+
+func TestStreamJobEventsLastEventID(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "k8s-tool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	s, err := New(Store(st))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := newRunningJob(5)
+	j.finish(nil, engine.Report{})
+	s.jobs[j.ID] = j
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   []string
+	}{
+		{name: "all", want: []string{"1", "2", "3", "4", "5", "6"}},
+		{name: "Last-Event-ID", header: "4", want: []string{"5", "6"}},
+		{name: "after query", query: "?after=2", want: []string{"3", "4", "5", "6"}},
+		{name: "query wins", header: "1", query: "?after=5", want: []string{"6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", srv.URL+"/api/jobs/job-1/events"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, line := range strings.Split(string(body), "\n") {
+				if id, ok := strings.CutPrefix(line, "id: "); ok {
+					ids = append(ids, id)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Fatalf("events = %v, want %v:\n%s", ids, tt.want, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"k8s-tool/app/store"
+)
+
+type Option func(s *Server) error
+
+func Addr(addr string) Option {
+	return func(s *Server) error {
+		s.addr = addr
+		return nil
+	}
+}
+
+func Store(st *store.Store) Option {
+	return func(s *Server) error {
+		s.store = st
+		return nil
+	}
+}
+
+// WithAuth enables authentication; without it every caller is an admin.
+func WithAuth(a *Auth) Option {
+	return func(s *Server) error {
+		s.auth = a
+		return nil
+	}
+}
+
+func TLS(certFile, keyFile string) Option {
+	return func(s *Server) error {
+		if (certFile == "") != (keyFile == "") {
+			return errors.New("tls needs both cert and key")
+		}
+		s.tlsCert = certFile
+		s.tlsKey = keyFile
+		return nil
+	}
+}
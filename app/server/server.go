@@ -0,0 +1,565 @@
+package server
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"k8s-tool/app/config"
+	"k8s-tool/app/engine"
+	"k8s-tool/app/store"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const maxConfigSize = 1 << 20
+
+//go:embed ui
+var ui embed.FS
+
+type Server struct {
+	addr    string
+	tlsCert string
+	tlsKey  string
+	store   *store.Store
+	auth    *Auth
+
+	mu      sync.Mutex
+	seq     map[string]int
+	configs map[string]*config.Config
+	jobs    map[string]*job
+}
+
+func New(opts ...Option) (*Server, error) {
+	s := &Server{
+		addr:    ":8080",
+		seq:     make(map[string]int),
+		configs: make(map[string]*config.Config),
+		jobs:    make(map[string]*job),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	if s.store == nil {
+		return nil, errors.New("server needs a store")
+	}
+	if err := s.failInterruptedJobs(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// failInterruptedJobs marks jobs left running by a previous process as failed.
+func (s *Server) failInterruptedJobs() error {
+	jobs, err := s.store.ListJobs("")
+	if err != nil {
+		return err
+	}
+	for _, sj := range jobs {
+		if sj.Status != jobPending && sj.Status != jobRunning {
+			continue
+		}
+		sj.Status = jobFailed
+		sj.Error = "interrupted by server restart"
+		sj.FinishedAt = time.Now()
+		if err := s.store.PutJob(sj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/steps", s.require(roleViewer, s.listSteps))
+	mux.HandleFunc("POST /api/validate", s.require(roleOperator, s.validate))
+	mux.HandleFunc("POST /api/configs", s.require(roleOperator, s.createConfig))
+	mux.HandleFunc("GET /api/configs", s.require(roleOperator, s.listConfigs))
+	mux.HandleFunc("GET /api/configs/{id}", s.require(roleOperator, s.getConfig))
+	mux.HandleFunc("POST /api/jobs", s.require(roleOperator, s.createJob))
+	mux.HandleFunc("GET /api/jobs", s.require(roleViewer, s.listJobs))
+	mux.HandleFunc("GET /api/jobs/{id}", s.require(roleViewer, s.getJob))
+	mux.HandleFunc("GET /api/jobs/{id}/logs", s.require(roleViewer, s.getJobLogs))
+	mux.HandleFunc("GET /api/jobs/{id}/events", s.require(roleViewer, s.streamJobEvents))
+	mux.HandleFunc("GET /api/clusters", s.require(roleViewer, s.listClusters))
+	mux.HandleFunc("GET /api/clusters/{name}", s.require(roleOperator, s.getCluster))
+	mux.HandleFunc("PUT /api/clusters/{name}", s.require(roleOperator, s.putCluster))
+	mux.HandleFunc("DELETE /api/clusters/{name}", s.require(roleAdmin, s.deleteCluster))
+	mux.HandleFunc("GET /api/clusters/{name}/jobs", s.require(roleViewer, s.listClusterJobs))
+	mux.HandleFunc("POST /api/clusters/{name}/jobs", s.require(roleOperator, s.createClusterJob))
+	mux.HandleFunc("GET /api/audit", s.require(roleAdmin, s.listAudit))
+	mux.HandleFunc("GET /api/whoami", s.require(roleViewer, s.whoami))
+
+	static, err := fs.Sub(ui, "ui")
+	if err != nil {
+		panic(err)
+	}
+	mux.Handle("GET /", s.require(roleViewer, http.FileServerFS(static).ServeHTTP))
+	return mux
+}
+
+// Run serves the API until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	if s.auth == nil {
+		logrus.Warn("authentication is disabled, every caller is an admin")
+	}
+	go func() {
+		if s.tlsCert != "" {
+			logrus.Infof("Server listening on %s (tls)", s.addr)
+			errCh <- srv.ListenAndServeTLS(s.tlsCert, s.tlsKey)
+			return
+		}
+		logrus.Infof("Server listening on %s", s.addr)
+		errCh <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+func (s *Server) nextID(prefix string) string {
+	s.seq[prefix]++
+	return prefix + strconv.Itoa(s.seq[prefix])
+}
+
+type stepView struct {
+	Num   int         `json:"num"`
+	Name  string      `json:"name"`
+	Steps []*stepView `json:"steps,omitempty"`
+}
+
+func newStepViews(steps []*engine.Step) []*stepView {
+	views := make([]*stepView, 0, len(steps))
+	for _, st := range steps {
+		views = append(views, &stepView{Num: st.Num, Name: st.Name, Steps: newStepViews(st.Steps)})
+	}
+	return views
+}
+
+func stepsFor(action string) ([]*engine.Step, error) {
+	switch action {
+	case "", "install":
+		return engine.DeploySteps, nil
+	case "update":
+		return engine.UpdateSteps, nil
+	case "reset":
+		return engine.ResetSteps, nil
+	case "upgrade":
+		return engine.UpgradeSteps, nil
+	default:
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+}
+
+func (s *Server) listSteps(w http.ResponseWriter, r *http.Request) {
+	steps, err := stepsFor(r.URL.Query().Get("action"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newStepViews(steps))
+}
+
+func readConfig(r *http.Request) (*config.Config, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxConfigSize))
+	if err != nil {
+		return nil, err
+	}
+	typ := "yaml"
+	if strings.Contains(r.Header.Get("Content-Type"), "json") {
+		typ = "json"
+	}
+	if err := config.Validate(data); err != nil {
+		return nil, err
+	}
+	return config.Parse(data, typ)
+}
+
+func (s *Server) createConfig(w http.ResponseWriter, r *http.Request) {
+	c, err := readConfig(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateConfig(c); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	s.mu.Lock()
+	id := s.nextID("cfg-")
+	s.configs[id] = c
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+}
+
+// validate parses and checks a config without storing it. The parsed config
+// is returned even when it is invalid so that clients can keep editing it.
+func (s *Server) validate(w http.ResponseWriter, r *http.Request) {
+	c, err := readConfig(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateConfig(c); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"config": c, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"config": c})
+}
+
+func validateConfig(c *config.Config) error {
+	e, err := engine.FromConfig(c, nil)
+	if err != nil {
+		return err
+	}
+	return e.Validate()
+}
+
+func (s *Server) listConfigs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.configs))
+	for id := range s.configs {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+	sort.Strings(ids)
+	writeJSON(w, http.StatusOK, ids)
+}
+
+func (s *Server) getConfig(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	c, ok := s.configs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("config not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+type jobRequest struct {
+	Config  string `json:"config"`
+	Cluster string `json:"cluster"`
+	Action  string `json:"action"`
+	Steps   string `json:"steps"`
+}
+
+func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Cluster != "" {
+		s.startClusterJob(w, r, req)
+		return
+	}
+	s.mu.Lock()
+	c, ok := s.configs[req.Config]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("config not found"))
+		return
+	}
+	s.startJob(w, r, req, c)
+}
+
+func (s *Server) startJob(w http.ResponseWriter, r *http.Request, req jobRequest, c *config.Config) {
+	if req.Action == "" {
+		req.Action = "install"
+	}
+	if _, err := stepsFor(req.Action); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	p := principalFrom(r.Context())
+	if min := actionRole(req.Action); p.Role < min {
+		writeError(w, http.StatusForbidden, fmt.Errorf("%s role required to %s", min, req.Action))
+		return
+	}
+	id, err := s.store.NextJobID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		if !j.active() {
+			continue
+		}
+		if (req.Cluster != "" && j.Cluster == req.Cluster) || (req.Config != "" && j.Config == req.Config) {
+			s.mu.Unlock()
+			writeError(w, http.StatusConflict, fmt.Errorf("job %s is still running", j.ID))
+			return
+		}
+	}
+	j := &job{Job: store.Job{
+		ID:        id,
+		Cluster:   req.Cluster,
+		Config:    req.Config,
+		Action:    req.Action,
+		Steps:     req.Steps,
+		Status:    jobPending,
+		User:      p.Name,
+		CreatedAt: time.Now(),
+	}}
+	s.jobs[j.ID] = j
+	s.mu.Unlock()
+
+	s.saveJob(j)
+	s.audit(r, "job."+j.Action, j.Cluster, j.ID, j.Steps)
+	go s.runJob(j, c)
+	writeJSON(w, http.StatusAccepted, j.snapshot())
+}
+
+func (s *Server) runJob(j *job, c *config.Config) {
+	j.start()
+	s.saveJob(j)
+	report, err := s.execute(j, c)
+	j.finish(err, report)
+	s.saveJob(j)
+
+	if data, err := j.marshalEvents(); err != nil {
+		logrus.Warnf("%s: encode events: %v", j.ID, err)
+	} else if err := s.store.PutLog(j.ID, data); err != nil {
+		logrus.Warnf("%s: save events: %v", j.ID, err)
+	}
+	if j.Cluster != "" {
+		if err := s.recordClusterRun(j.snapshot()); err != nil {
+			logrus.Warnf("%s: update cluster %s: %v", j.ID, j.Cluster, err)
+		}
+	}
+
+	// 结束的任务从存储中读取
+	s.mu.Lock()
+	delete(s.jobs, j.ID)
+	s.mu.Unlock()
+}
+
+func (s *Server) execute(j *job, c *config.Config) (engine.Report, error) {
+	log := logrus.New()
+	log.SetOutput(j.writer("", "log"))
+	output := func(addr string) (io.Writer, io.Writer) {
+		return j.writer(addr, "stdout"), j.writer(addr, "stderr")
+	}
+	e, err := engine.FromConfig(c, output, engine.Logger(log))
+	if err != nil {
+		return engine.Report{}, err
+	}
+	e.OnNextStep = func(name string) {
+		j.setStep(name)
+		s.saveJob(j)
+	}
+	switch j.Action {
+	case "update":
+		err = e.Update(j.Steps)
+	case "reset":
+		err = e.Reset(j.Steps)
+	case "upgrade":
+		err = e.Upgrade(j.Steps)
+	default:
+		err = e.Install(j.Steps)
+	}
+	return e.Report(), err
+}
+
+func (s *Server) saveJob(j *job) {
+	if err := s.store.PutJob(j.snapshot()); err != nil {
+		logrus.Warnf("%s: save job: %v", j.ID, err)
+	}
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.store.ListJobs(r.URL.Query().Get("cluster"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// lookupJob returns the running job or rebuilds a finished one from the store.
+func (s *Server) lookupJob(w http.ResponseWriter, r *http.Request) (*job, bool) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	j, ok := s.jobs[id]
+	s.mu.Unlock()
+	if ok {
+		return j, true
+	}
+
+	sj, err := s.store.GetJob(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return nil, false
+	}
+	data, err := s.store.GetLog(id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	j, err = restoreJob(sj, data)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return j, true
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	if j, ok := s.lookupJob(w, r); ok {
+		writeJSON(w, http.StatusOK, j.snapshot())
+	}
+}
+
+func (s *Server) getJobLogs(w http.ResponseWriter, r *http.Request) {
+	if j, ok := s.lookupJob(w, r); ok {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(j.logs())
+	}
+}
+
+// streamJobEvents sends the job events as Server-Sent Events. Buffered
+// history is replayed first, starting after Last-Event-ID when given, and the
+// stream ends with the result event.
+func (s *Server) streamJobEvents(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	after, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	if v := r.URL.Query().Get("after"); v != "" {
+		after, _ = strconv.Atoi(v)
+	}
+	history, ch, cancel := j.subscribe(after)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, ev := range history {
+		if err := writeEvent(w, ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	if ch == nil {
+		return
+	}
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, ev event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
+
+func (s *Server) audit(r *http.Request, action, cluster, jobID, steps string) {
+	p := principalFrom(r.Context())
+	entry := &store.AuditEntry{
+		Time:    time.Now(),
+		User:    p.Name,
+		Role:    p.Role.String(),
+		Action:  action,
+		Cluster: cluster,
+		Job:     jobID,
+		Steps:   steps,
+		Remote:  r.RemoteAddr,
+	}
+	logrus.Infof("audit: %s (%s) %s cluster=%q job=%q from %s", entry.User, entry.Role, action, cluster, jobID, entry.Remote)
+	if err := s.store.AddAudit(entry); err != nil {
+		logrus.Warnf("save audit entry: %v", err)
+	}
+}
+
+func (s *Server) listAudit(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.store.ListAudit()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) whoami(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r.Context())
+	writeJSON(w, http.StatusOK, map[string]string{"name": p.Name, "role": p.Role.String()})
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	return json.NewDecoder(io.LimitReader(r.Body, maxConfigSize)).Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Warnf("encode response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"k8s-tool/app/config"
+	"k8s-tool/app/store"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+nodes:
+  - address: 10.0.0.1
+    hostname: master1
+    role: [etcd, controlplane, worker]
+`
+
+// newJobServer serves a server without authentication whose config cfg-1
+// and cluster prod each have a running job.
+func newJobServer(t *testing.T, opts ...Option) *httptest.Server {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "k8s-tool.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	if err := st.PutCluster(&store.Cluster{Name: "prod", Config: &config.Config{}, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(append([]Option{Store(st)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.configs["cfg-1"] = &config.Config{}
+	s.jobs["job-1"] = &job{Job: store.Job{ID: "job-1", Config: "cfg-1", Status: jobRunning}}
+	s.jobs["job-2"] = &job{Job: store.Job{ID: "job-2", Cluster: "prod", Status: jobPending}}
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, contentType, body string) (int, map[string]any) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var v map[string]any
+	json.NewDecoder(resp.Body).Decode(&v)
+	return resp.StatusCode, v
+}
+
+func TestCreateConfig(t *testing.T) {
+	srv := newJobServer(t)
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+		wantErr     string
+	}{
+		{name: "valid", path: "/api/configs", body: testConfig, want: http.StatusCreated},
+		{name: "valid json", path: "/api/configs", contentType: "application/json", body: `{"nodes":[{"address":"10.0.0.1","role":["etcd","controlplane","worker"]}]}`, want: http.StatusCreated},
+		{name: "invalid yaml", path: "/api/configs", body: "nodes: [\n", want: http.StatusBadRequest},
+		{name: "unknown key", path: "/api/configs", body: "vips: 10.0.0.100\n" + testConfig, want: http.StatusBadRequest, wantErr: "vips: unknown key"},
+		{name: "invalid value", path: "/api/configs", body: "vip: 10.0.0.300\n" + testConfig, want: http.StatusBadRequest, wantErr: "is not a valid ip"},
+		{name: "invalid config", path: "/api/configs", body: "loadBalancer:\n  mode: external\n" + testConfig, want: http.StatusUnprocessableEntity, wantErr: "address is required"},
+		{name: "validate", path: "/api/validate", body: testConfig, want: http.StatusOK},
+		{name: "validate invalid yaml", path: "/api/validate", body: "nodes: [\n", want: http.StatusBadRequest},
+		{name: "validate invalid config", path: "/api/validate", body: "loadBalancer:\n  mode: external\n" + testConfig, want: http.StatusUnprocessableEntity, wantErr: "address is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := do(t, srv, "POST", tt.path, tt.contentType, tt.body)
+			if code != tt.want {
+				t.Fatalf("POST %s = %d %v, want %d", tt.path, code, body, tt.want)
+			}
+			if msg, _ := body["error"].(string); !strings.Contains(msg, tt.wantErr) {
+				t.Fatalf("POST %s error = %q, want %q", tt.path, msg, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateJob(t *testing.T) {
+	srv := newJobServer(t)
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{name: "config running", path: "/api/jobs", body: `{"config":"cfg-1"}`, want: http.StatusConflict},
+		{name: "config running other action", path: "/api/jobs", body: `{"config":"cfg-1","action":"reset"}`, want: http.StatusConflict},
+		{name: "cluster pending", path: "/api/clusters/prod/jobs", body: `{"action":"update"}`, want: http.StatusConflict},
+		{name: "cluster by body", path: "/api/jobs", body: `{"cluster":"prod","action":"upgrade"}`, want: http.StatusConflict},
+		{name: "unknown config", path: "/api/jobs", body: `{"config":"cfg-9"}`, want: http.StatusNotFound},
+		{name: "unknown cluster", path: "/api/clusters/dev/jobs", body: `{}`, want: http.StatusNotFound},
+		{name: "unknown action", path: "/api/jobs", body: `{"config":"cfg-1","action":"destroy"}`, want: http.StatusBadRequest},
+		{name: "invalid body", path: "/api/jobs", body: `{`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := do(t, srv, "POST", tt.path, "application/json", tt.body); code != tt.want {
+				t.Fatalf("POST %s %s = %d %v, want %d", tt.path, tt.body, code, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobActionRoles(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadAuth(writeAuthConfig(t, "users:\n"+
+		"  - {name: viewer, password: '"+hash+"', role: viewer}\n"+
+		"  - {name: operator, password: '"+hash+"', role: operator}\n"+
+		"  - {name: admin, password: '"+hash+"', role: admin}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newJobServer(t, WithAuth(a))
+	// a job passing the role checks runs into the job already running
+	want := map[string]map[string]int{
+		"viewer":   {"install": http.StatusForbidden, "update": http.StatusForbidden, "reset": http.StatusForbidden, "upgrade": http.StatusForbidden},
+		"operator": {"install": http.StatusConflict, "update": http.StatusConflict, "reset": http.StatusForbidden, "upgrade": http.StatusForbidden},
+		"admin":    {"install": http.StatusConflict, "update": http.StatusConflict, "reset": http.StatusConflict, "upgrade": http.StatusConflict},
+	}
+	for user, actions := range want {
+		for action, code := range actions {
+			t.Run(user+" "+action, func(t *testing.T) {
+				req, err := http.NewRequest("POST", srv.URL+"/api/jobs", strings.NewReader(`{"config":"cfg-1","action":"`+action+`"}`))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.SetBasicAuth(user, "secret")
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != code {
+					t.Fatalf("%s starting %s = %d, want %d", user, action, resp.StatusCode, code)
+				}
+			})
+		}
+	}
+}
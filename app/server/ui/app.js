@@ -0,0 +1,305 @@
+'use strict';
+
+const $ = (sel) => document.querySelector(sel);
+
+const roles = ['etcd', 'controlplane', 'worker'];
+let source = null;
+let logs = [];
+// the last loaded config, fields without an input (node groups, kubeadm,
+// node labels and taints) are kept from it when the form is read
+let loaded = {};
+
+function encode(s) {
+  const bytes = new TextEncoder().encode(s);
+  let bin = '';
+  bytes.forEach((b) => { bin += String.fromCharCode(b); });
+  return btoa(bin);
+}
+
+function decode(s) {
+  try {
+    const bin = atob(s || '');
+    return new TextDecoder().decode(Uint8Array.from(bin, (c) => c.charCodeAt(0)));
+  } catch (e) {
+    return '';
+  }
+}
+
+function message(text, kind) {
+  const el = $('#message');
+  el.textContent = text;
+  el.className = kind || '';
+}
+
+async function api(method, path, body, type) {
+  const opts = { method, headers: {} };
+  if (body !== undefined) {
+    opts.headers['Content-Type'] = type || 'application/json';
+    opts.body = typeof body === 'string' ? body : JSON.stringify(body);
+  }
+  const resp = await fetch(path, opts);
+  const data = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    throw new Error(data.error || resp.statusText);
+  }
+  return data;
+}
+
+function addNode(n) {
+  const row = $('#node-row').content.firstElementChild.cloneNode(true);
+  n = n || {};
+  row.node = n;
+  row.querySelector('[name=address]').value = n.address || '';
+  row.querySelector('[name=hostname]').value = n.hostname || '';
+  row.querySelector('[name=port]').value = n.port || 22;
+  row.querySelector('[name=username]').value = n.username ? decode(n.username) : 'root';
+  row.querySelector('[name=password]').value = decode(n.password);
+  row.querySelector('[name=keyPath]').value = n.keyPath || '';
+  (n.role || []).forEach((r) => {
+    const box = row.querySelector(`[name=${r.toLowerCase()}]`);
+    if (box) box.checked = true;
+  });
+  row.querySelector('.remove').addEventListener('click', () => row.remove());
+  $('#nodes tbody').appendChild(row);
+}
+
+function readConfig() {
+  const c = structuredClone(loaded);
+  c.nodes = [];
+  document.querySelectorAll('[data-path]').forEach((el) => {
+    const path = el.dataset.path.split('.');
+    const key = path.pop();
+    let obj = c;
+    path.forEach((p) => {
+      obj[p] = obj[p] || {};
+      obj = obj[p];
+    });
+    obj[key] = el.type === 'number' ? (parseInt(el.value, 10) || 0) : el.value.trim();
+  });
+  document.querySelectorAll('#nodes tbody tr').forEach((row) => {
+    const v = (name) => row.querySelector(`[name=${name}]`).value.trim();
+    c.nodes.push({
+      ...structuredClone(row.node),
+      address: v('address'),
+      hostname: v('hostname'),
+      role: roles.filter((r) => row.querySelector(`[name=${r}]`).checked),
+      port: parseInt(v('port'), 10) || 22,
+      username: encode(v('username')),
+      password: encode(row.querySelector('[name=password]').value),
+      keyPath: v('keyPath'),
+    });
+  });
+  return c;
+}
+
+function writeConfig(c) {
+  loaded = structuredClone(c);
+  document.querySelectorAll('[data-path]').forEach((el) => {
+    const v = el.dataset.path.split('.').reduce((obj, p) => (obj || {})[p], c);
+    el.value = v || (el.tagName === 'SELECT' ? el.options[0].value : '');
+  });
+  $('#nodes tbody').innerHTML = '';
+  (c.nodes || []).forEach(addNode);
+}
+
+async function validate() {
+  try {
+    await api('POST', '/api/validate', readConfig());
+    message('Config is valid.', 'ok');
+    return true;
+  } catch (e) {
+    message(e.message, 'error');
+    return false;
+  }
+}
+
+async function loadSteps(action) {
+  const steps = await api('GET', `/api/steps?action=${action}`);
+  const list = $('#step-list');
+  list.innerHTML = '';
+  steps.forEach((s) => {
+    const li = document.createElement('li');
+    li.value = s.num;
+    li.textContent = s.name;
+    li.dataset.name = s.name;
+    list.appendChild(li);
+  });
+}
+
+function markStep(name) {
+  let found = false;
+  document.querySelectorAll('#step-list li').forEach((li) => {
+    if (li.classList.contains('running')) {
+      li.classList.replace('running', 'done');
+    }
+    if (!found && li.dataset.name === name && !li.classList.contains('done')) {
+      li.classList.add('running');
+      found = true;
+    }
+  });
+}
+
+function renderLog() {
+  const filter = $('#log-node').value;
+  const el = $('#log');
+  const atBottom = el.scrollTop + el.clientHeight >= el.scrollHeight - 4;
+  el.innerHTML = '';
+  logs.filter((l) => !filter || l.node === filter).forEach((l) => appendLog(l, el));
+  if (atBottom) el.scrollTop = el.scrollHeight;
+}
+
+function appendLog(l, el) {
+  if (l.node) {
+    const tag = document.createElement('span');
+    tag.className = 'node';
+    tag.textContent = `[${l.node}] `;
+    el.appendChild(tag);
+  }
+  const text = document.createElement('span');
+  if (l.stream === 'stderr') text.className = 'stderr';
+  text.textContent = l.data;
+  el.appendChild(text);
+}
+
+function onLog(l) {
+  logs.push(l);
+  const select = $('#log-node');
+  if (l.node && !Array.from(select.options).some((o) => o.value === l.node)) {
+    select.add(new Option(l.node, l.node));
+  }
+  const filter = select.value;
+  if (!filter || l.node === filter) {
+    const el = $('#log');
+    const atBottom = el.scrollTop + el.clientHeight >= el.scrollHeight - 4;
+    appendLog(l, el);
+    if (atBottom) el.scrollTop = el.scrollHeight;
+  }
+}
+
+function setStatus(status) {
+  const el = $('#job-status');
+  el.textContent = status ? `(${status})` : '';
+  el.className = status || '';
+}
+
+function watch(job) {
+  if (source) source.close();
+  logs = [];
+  $('#log').innerHTML = '';
+  setStatus(job.status);
+  source = new EventSource(`/api/jobs/${job.id}/events`);
+  source.addEventListener('step', (e) => markStep(JSON.parse(e.data).data));
+  source.addEventListener('log', (e) => onLog(JSON.parse(e.data)));
+  source.addEventListener('result', (e) => {
+    const r = JSON.parse(e.data);
+    source.close();
+    source = null;
+    document.querySelectorAll('#step-list li.running').forEach((li) => {
+      li.classList.replace('running', r.status === 'succeeded' ? 'done' : 'failed');
+    });
+    setStatus(r.status);
+    message(r.error || 'Job finished.', r.error ? 'error' : 'ok');
+    $('#start').disabled = false;
+  });
+  setStatus('running');
+}
+
+async function loadClusters() {
+  const select = $('#clusters');
+  select.length = 1;
+  (await api('GET', '/api/clusters')).forEach((c) => {
+    const info = [c.kubernetesVersion, (c.components || []).join(', ')].filter(Boolean).join(' · ');
+    select.add(new Option(info ? `${c.name} (${info})` : c.name, c.name));
+  });
+}
+
+async function openCluster(name) {
+  if (!name) return;
+  try {
+    const c = await api('GET', `/api/clusters/${encodeURIComponent(name)}`);
+    writeConfig(c.config);
+    $('#cluster-name').value = c.name;
+    message(`Loaded cluster ${c.name}.`, 'ok');
+  } catch (e) {
+    message(e.message, 'error');
+  }
+}
+
+async function saveCluster() {
+  const name = $('#cluster-name').value.trim();
+  if (!name) {
+    message('Cluster name is required to save.', 'error');
+    return false;
+  }
+  try {
+    await api('PUT', `/api/clusters/${encodeURIComponent(name)}`, readConfig());
+    await loadClusters();
+    message(`Saved cluster ${name}.`, 'ok');
+    return true;
+  } catch (e) {
+    message(e.message, 'error');
+    return false;
+  }
+}
+
+async function start() {
+  if (!(await validate())) return;
+  const action = $('#action').value;
+  const name = $('#cluster-name').value.trim();
+  if (name && !(await saveCluster())) return;
+  $('#start').disabled = true;
+  try {
+    const req = { action, steps: $('#steps').value.trim() };
+    if (name) {
+      req.cluster = name;
+    } else {
+      req.config = (await api('POST', '/api/configs', readConfig())).id;
+    }
+    await loadSteps(action);
+    const job = await api('POST', '/api/jobs', req);
+    message(`Job ${job.id} started.`, 'ok');
+    watch(job);
+  } catch (e) {
+    message(e.message, 'error');
+    $('#start').disabled = false;
+  }
+}
+
+async function importFile(file) {
+  try {
+    const text = await file.text();
+    const type = file.name.endsWith('.json') ? 'application/json' : 'application/yaml';
+    const resp = await fetch('/api/validate', { method: 'POST', headers: { 'Content-Type': type }, body: text });
+    const data = await resp.json();
+    if (!data.config) {
+      throw new Error(data.error || resp.statusText);
+    }
+    writeConfig(data.config);
+    message(data.error ? `Imported ${file.name}: ${data.error}` : `Imported ${file.name}.`, data.error ? 'error' : 'ok');
+  } catch (e) {
+    message(e.message, 'error');
+  }
+}
+
+function exportConfig() {
+  const blob = new Blob([JSON.stringify(readConfig(), null, 2)], { type: 'application/json' });
+  const a = document.createElement('a');
+  a.href = URL.createObjectURL(blob);
+  a.download = 'config.json';
+  a.click();
+  URL.revokeObjectURL(a.href);
+}
+
+$('#add-node').addEventListener('click', () => addNode());
+$('#validate').addEventListener('click', validate);
+$('#start').addEventListener('click', start);
+$('#action').addEventListener('change', (e) => loadSteps(e.target.value));
+$('#log-node').addEventListener('change', renderLog);
+$('#import').addEventListener('change', (e) => e.target.files[0] && importFile(e.target.files[0]));
+$('#export').addEventListener('click', exportConfig);
+$('#save').addEventListener('click', saveCluster);
+$('#clusters').addEventListener('change', (e) => openCluster(e.target.value));
+
+addNode({ role: roles });
+loadSteps('install');
+loadClusters().catch((e) => message(e.message, 'error'));
@@ -0,0 +1,243 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"k8s-tool/app/config"
+	"k8s-tool/app/engine"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrNotFound = errors.New("not found")
+
+var (
+	clustersBucket = []byte("clusters")
+	jobsBucket     = []byte("jobs")
+	logsBucket     = []byte("logs")
+	auditBucket    = []byte("audit")
+)
+
+type Cluster struct {
+	Name              string         `json:"name"`
+	Config            *config.Config `json:"config"`
+	KubernetesVersion string         `json:"kubernetesVersion,omitempty"`
+	Components        []string       `json:"components,omitempty"`
+	LastJob           string         `json:"lastJob,omitempty"`
+	CreatedAt         time.Time      `json:"createdAt"`
+	UpdatedAt         time.Time      `json:"updatedAt"`
+}
+
+type Job struct {
+	ID         string         `json:"id"`
+	Cluster    string         `json:"cluster,omitempty"`
+	Config     string         `json:"config,omitempty"`
+	Action     string         `json:"action"`
+	Steps      string         `json:"steps,omitempty"`
+	Status     string         `json:"status"`
+	Step       string         `json:"step,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	User       string         `json:"user,omitempty"`
+	Report     *engine.Report `json:"report,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+}
+
+// AuditEntry records who did what to which cluster.
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Role    string    `json:"role"`
+	Action  string    `json:"action"`
+	Cluster string    `json:"cluster,omitempty"`
+	Job     string    `json:"job,omitempty"`
+	Steps   string    `json:"steps,omitempty"`
+	Remote  string    `json:"remote,omitempty"`
+}
+
+type Store struct {
+	db *bolt.DB
+}
+
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{clustersBucket, jobsBucket, logsBucket, auditBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) PutCluster(c *Cluster) error {
+	return s.put(clustersBucket, c.Name, c)
+}
+
+func (s *Store) GetCluster(name string) (*Cluster, error) {
+	c := new(Cluster)
+	if err := s.get(clustersBucket, name, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Store) ListClusters() ([]*Cluster, error) {
+	var clusters []*Cluster
+	err := s.each(clustersBucket, func(v []byte) error {
+		c := new(Cluster)
+		if err := json.Unmarshal(v, c); err != nil {
+			return err
+		}
+		clusters = append(clusters, c)
+		return nil
+	})
+	return clusters, err
+}
+
+func (s *Store) DeleteCluster(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(clustersBucket)
+		if b.Get([]byte(name)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+// NextJobID returns an id that stays unique across server restarts.
+func (s *Store) NextJobID() (string, error) {
+	var id string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		seq, err := tx.Bucket(jobsBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		id = fmt.Sprintf("job-%d", seq)
+		return nil
+	})
+	return id, err
+}
+
+func (s *Store) PutJob(j *Job) error {
+	return s.put(jobsBucket, j.ID, j)
+}
+
+func (s *Store) GetJob(id string) (*Job, error) {
+	j := new(Job)
+	if err := s.get(jobsBucket, id, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// ListJobs returns the jobs ordered by creation time, optionally limited to
+// one cluster.
+func (s *Store) ListJobs(cluster string) ([]*Job, error) {
+	var jobs []*Job
+	err := s.each(jobsBucket, func(v []byte) error {
+		j := new(Job)
+		if err := json.Unmarshal(v, j); err != nil {
+			return err
+		}
+		if cluster == "" || j.Cluster == cluster {
+			jobs = append(jobs, j)
+		}
+		return nil
+	})
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].CreatedAt.Before(jobs[k].CreatedAt) })
+	return jobs, err
+}
+
+func (s *Store) PutLog(id string, data []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(logsBucket).Put([]byte(id), data)
+	})
+}
+
+func (s *Store) GetLog(id string) ([]byte, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(logsBucket).Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		data = append([]byte(nil), v...)
+		return nil
+	})
+	return data, err
+}
+
+func (s *Store) AddAudit(a *AuditEntry) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(fmt.Sprintf("%020d", seq)), data)
+	})
+}
+
+// ListAudit returns the audit entries in the order they were added.
+func (s *Store) ListAudit() ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	err := s.each(auditBucket, func(v []byte) error {
+		a := new(AuditEntry)
+		if err := json.Unmarshal(v, a); err != nil {
+			return err
+		}
+		entries = append(entries, a)
+		return nil
+	})
+	return entries, err
+}
+
+func (s *Store) put(bucket []byte, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), data)
+	})
+}
+
+func (s *Store) get(bucket []byte, key string, v any) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, v)
+	})
+}
+
+func (s *Store) each(bucket []byte, fn func(v []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(_, v []byte) error {
+			return fn(v)
+		})
+	})
+}
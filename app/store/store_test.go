@@ -0,0 +1,203 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"k8s-tool/app/config"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestClusters(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "k8s-tool.db"))
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	prod := &Cluster{Name: "prod", Config: &config.Config{Vip: "10.0.0.100"}, KubernetesVersion: "v1.28.2", Components: []string{"calico"}, CreatedAt: created}
+	dev := &Cluster{Name: "dev", Config: &config.Config{}, CreatedAt: created}
+	for _, c := range []*Cluster{prod, dev} {
+		if err := s.PutCluster(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.GetCluster("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "prod" || got.Config.Vip != "10.0.0.100" || got.KubernetesVersion != "v1.28.2" ||
+		!reflect.DeepEqual(got.Components, prod.Components) || !got.CreatedAt.Equal(created) {
+		t.Fatalf("GetCluster() = %+v, want %+v", got, prod)
+	}
+
+	prod.LastJob = "job-1"
+	if err := s.PutCluster(prod); err != nil {
+		t.Fatal(err)
+	}
+	clusters, err := s.ListClusters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range clusters {
+		names = append(names, c.Name+":"+c.LastJob)
+	}
+	if want := []string{"dev:", "prod:job-1"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("ListClusters() = %v, want %v", names, want)
+	}
+
+	if err := s.DeleteCluster("dev"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "get deleted", err: func() error { _, err := s.GetCluster("dev"); return err }()},
+		{name: "delete deleted", err: s.DeleteCluster("dev")},
+		{name: "get unknown", err: func() error { _, err := s.GetCluster("qa"); return err }()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, ErrNotFound) {
+				t.Fatalf("error = %v, want ErrNotFound", tt.err)
+			}
+		})
+	}
+}
+
+func TestNextJobID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "k8s-tool.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := s.NextJobID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	s.Close()
+
+	// ids keep counting after a restart
+	s = openTestStore(t, path)
+	id, err := s.NextJobID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = append(ids, id)
+	if want := []string{"job-1", "job-2", "job-3", "job-4"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("NextJobID() = %v, want %v", ids, want)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "k8s-tool.db"))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	jobs := []*Job{
+		{ID: "job-3", Cluster: "prod", Action: "upgrade", CreatedAt: start.Add(3 * time.Hour)},
+		{ID: "job-1", Cluster: "prod", Action: "install", CreatedAt: start.Add(time.Hour)},
+		{ID: "job-10", Config: "cfg-1", Action: "install", CreatedAt: start.Add(10 * time.Hour)},
+		{ID: "job-2", Cluster: "dev", Action: "install", CreatedAt: start.Add(2 * time.Hour)},
+	}
+	for _, j := range jobs {
+		if err := s.PutJob(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		cluster string
+		want    []string
+	}{
+		{cluster: "", want: []string{"job-1", "job-2", "job-3", "job-10"}},
+		{cluster: "prod", want: []string{"job-1", "job-3"}},
+		{cluster: "qa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cluster, func(t *testing.T) {
+			got, err := s.ListJobs(tt.cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, j := range got {
+				ids = append(ids, j.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Fatalf("ListJobs(%q) = %v, want %v", tt.cluster, ids, tt.want)
+			}
+		})
+	}
+	if _, err := s.GetJob("job-9"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetJob() of unknown job error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "k8s-tool.db"))
+	if _, err := s.GetLog("job-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetLog() before PutLog error = %v, want ErrNotFound", err)
+	}
+	// the events of a job are saved again as it goes on
+	for _, data := range []string{`[{"id":1}]`, `[{"id":1},{"id":2}]`} {
+		if err := s.PutLog("job-1", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.GetLog("job-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Fatalf("GetLog() = %s, want %s", got, data)
+		}
+	}
+	got, err := s.GetLog("job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the returned slice must stay valid after the transaction
+	got[0] = 'x'
+	again, err := s.GetLog("job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != `[{"id":1},{"id":2}]` {
+		t.Fatalf("GetLog() = %s after changing an earlier result", again)
+	}
+}
+
+func TestAuditOrder(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "k8s-tool.db"))
+	var want []string
+	for i := 1; i <= 12; i++ {
+		action := fmt.Sprintf("job.install-%d", i)
+		want = append(want, action)
+		if err := s.AddAudit(&AuditEntry{Time: time.Now(), User: "admin", Role: "admin", Action: action}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := s.ListAudit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range entries {
+		got = append(got, a.Action)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ListAudit() = %v, want %v", got, want)
+	}
+}
@@ -1,14 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"k8s-tool/app/config"
 	"k8s-tool/app/engine"
 	"k8s-tool/app/node"
+	"k8s-tool/app/server"
+	"k8s-tool/app/store"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
 var VERSION = "0.0.1"
@@ -19,8 +37,23 @@ func main() {
 		Usage:       "automatic install kubernetes and other components",
 		Description: "run without subcommands to start the server",
 		Commands: []*cli.Command{
+			newInstallCmd(context.Background()),
+			newUpgradeCmd(context.Background()),
+			newBackupCmd(context.Background()),
+			newRestoreCmd(context.Background()),
+			newCertsCmd(context.Background()),
+			newKubeconfigCmd(context.Background()),
+			newStatusCmd(context.Background()),
+			newDiffCmd(context.Background()),
+			newExecCmd(context.Background()),
+			newCopyCmd(context.Background()),
+			newFetchCmd(context.Background()),
+			newImportCmd(context.Background()),
+			newConfigCmd(context.Background()),
 			newWebCmd(context.Background()),
 		},
+		Flags:   serveFlags(),
+		Action:  serve,
 		Version: VERSION,
 	}
 	if err := app.Run(os.Args); err != nil {
@@ -29,11 +62,11 @@ func main() {
 	}
 }
 
-func newWebCmd(ctx context.Context) *cli.Command {
+func newInstallCmd(ctx context.Context) *cli.Command {
 	return &cli.Command{
 		Name:        "install",
-		Description: "read a config file and immediately install",
-		Flags: []cli.Flag{
+		Description: "read a config file and immediately install, --nodes limits the per-node steps",
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:        "config",
 				Usage:       "path to config file",
@@ -44,6 +77,11 @@ func newWebCmd(ctx context.Context) *cli.Command {
 				Usage: "update k8s join new node",
 				Value: false,
 			},
+			&cli.BoolFlag{
+				Name:  "reset",
+				Usage: "reset k8s on all nodes",
+				Value: false,
+			},
 			&cli.BoolFlag{
 				Name:  "steps",
 				Usage: "print steps",
@@ -54,56 +92,953 @@ func newWebCmd(ctx context.Context) *cli.Command {
 				Usage:       "install step",
 				DefaultText: "",
 			},
-		},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "validate the config and print the generated kubeadm config without connecting to nodes",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "inventory",
+				Usage: "take the nodes from an Ansible inventory or CSV file instead of the config, see import",
+			},
+			&cli.StringSliceFlag{
+				Name:  "group",
+				Usage: "role=group mapping for --inventory, replaces the default groups of that role",
+			},
+		}, selectorFlags()...),
 		Action: install,
 	}
 }
 
+func newUpgradeCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "upgrade",
+		Description: "upgrade the cluster to the kubernetesVersion of the config file",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "path to config file",
+				DefaultText: "config.yml",
+			},
+			&cli.BoolFlag{
+				Name:  "steps",
+				Usage: "print steps",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:        "step",
+				Usage:       "upgrade step",
+				DefaultText: "",
+			},
+			&cli.IntFlag{
+				Name:  "batch",
+				Usage: "number of workers drained and upgraded at once",
+				Value: 1,
+			},
+		},
+		Action: upgrade,
+	}
+}
+
+func newBackupCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "backup",
+		Description: "back up cluster data",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "etcd",
+				Description: "save an etcd snapshot on the first control plane and download it",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "config",
+						Usage:       "path to config file",
+						DefaultText: "config.yml",
+					},
+					&cli.StringFlag{
+						Name:  "dir",
+						Usage: "directory the snapshots are kept in",
+						Value: "backup",
+					},
+					&cli.IntFlag{
+						Name:  "keep",
+						Usage: "number of snapshots to keep in dir, 0 keeps all",
+						Value: 7,
+					},
+				},
+				Action: backupEtcd,
+			},
+		},
+	}
+}
+
+func newRestoreCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "restore",
+		Description: "restore cluster data",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "etcd",
+				Description: "restore every etcd member from a snapshot, the API server is down meanwhile",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "config",
+						Usage:       "path to config file",
+						DefaultText: "config.yml",
+					},
+					&cli.StringFlag{
+						Name:  "snapshot",
+						Usage: "path to the snapshot taken by backup etcd",
+					},
+					&cli.BoolFlag{
+						Name:  "steps",
+						Usage: "print steps",
+						Value: false,
+					},
+					&cli.StringFlag{
+						Name:        "step",
+						Usage:       "restore step",
+						DefaultText: "",
+					},
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: "do not ask for confirmation",
+						Value: false,
+					},
+				},
+				Action: restoreEtcd,
+			},
+		},
+	}
+}
+
+func newCertsCmd(ctx context.Context) *cli.Command {
+	configFlag := &cli.StringFlag{
+		Name:        "config",
+		Usage:       "path to config file",
+		DefaultText: "config.yml",
+	}
+	return &cli.Command{
+		Name:        "certs",
+		Description: "check and renew the kubeadm certificates",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "check",
+				Description: "show the certificate expiration of every control plane node",
+				Flags: []cli.Flag{
+					configFlag,
+					&cli.IntFlag{
+						Name:  "warn",
+						Usage: "days before expiration a certificate is reported as expiring",
+						Value: 30,
+					},
+				},
+				Action: checkCerts,
+			},
+			{
+				Name:        "renew",
+				Description: "renew the certificates and restart the control plane one node at a time",
+				Flags:       []cli.Flag{configFlag},
+				Action:      renewCerts,
+			},
+		},
+	}
+}
+
+func newKubeconfigCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "kubeconfig",
+		Description: "download the admin kubeconfig pointed at the vip, or mint one for a restricted user",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "path to config file",
+				DefaultText: "config.yml",
+			},
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "cluster name used for the cluster, user and context entries",
+				Value: "kubernetes",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "file to write the kubeconfig to, stdout when empty",
+			},
+			&cli.BoolFlag{
+				Name:  "merge",
+				Usage: "merge into $KUBECONFIG or ~/.kube/config instead of writing it out",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "user",
+				Usage: "mint a kubeconfig for this user with a new client certificate instead of the admin one",
+			},
+			&cli.StringSliceFlag{
+				Name:  "group",
+				Usage: "group of the user, can be repeated",
+			},
+			&cli.StringFlag{
+				Name:  "clusterrole",
+				Usage: "cluster role bound to the user, e.g. view",
+			},
+			&cli.DurationFlag{
+				Name:  "expiration",
+				Usage: "lifetime of the user certificate",
+				Value: 365 * 24 * time.Hour,
+			},
+		},
+		Action: kubeconfig,
+	}
+}
+
+func newStatusCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "status",
+		Description: "summarize nodes and components, rows marked with ! need attention",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "path to config file",
+				DefaultText: "config.yml",
+			},
+		},
+		Action: status,
+	}
+}
+
+func newDiffCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "diff",
+		Description: "compare the config with the live cluster and suggest how to reconcile them",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "path to config file",
+				DefaultText: "config.yml",
+			},
+		},
+		Action: diff,
+	}
+}
+
+func selectorFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "nodes",
+			Usage: "select nodes by role=worker, hostname=worker-*, address or CIDR, or any config label like zone=a; terms of different keys must all match",
+		},
+	}
+}
+
+func selector(ctx *cli.Context) (engine.Selector, error) {
+	return engine.ParseSelector(ctx.StringSlice("nodes"))
+}
+
+func newExecCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "exec",
+		ArgsUsage:   " [--nodes SELECTOR] -- COMMAND",
+		Description: "run a shell command on the selected nodes concurrently, identical outputs are printed once",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "path to config file",
+				DefaultText: "config.yml",
+			},
+		}, selectorFlags()...),
+		Action: execOnNodes,
+	}
+}
+
+func newCopyCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "cp",
+		ArgsUsage:   " SRC DST",
+		Description: "copy a local file or directory to DST on the selected nodes, into DST when it ends in / or is a directory, relative DST is under the home directory",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "path to config file",
+				DefaultText: "config.yml",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Usage: "octal mode applied recursively, e.g. 0644",
+			},
+			&cli.StringFlag{
+				Name:  "owner",
+				Usage: "user[:group] applied recursively",
+			},
+		}, selectorFlags()...),
+		Action: copyToNodes,
+	}
+}
+
+func newFetchCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "fetch",
+		ArgsUsage:   " SRC",
+		Description: "download a file or directory from the selected nodes into DIR/<hostname>/",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "path to config file",
+				DefaultText: "config.yml",
+			},
+			&cli.StringFlag{
+				Name:  "dir",
+				Usage: "local directory receiving one subdirectory per node",
+				Value: "fetched",
+			},
+		}, selectorFlags()...),
+		Action: fetchFromNodes,
+	}
+}
+
+func newImportCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "import",
+		ArgsUsage:   " INVENTORY",
+		Description: "print the nodes of an Ansible inventory (ini or yaml) or CSV file as config",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "ini, yaml or csv, default from the file extension",
+			},
+			&cli.StringSliceFlag{
+				Name:  "group",
+				Usage: "role=group mapping, replaces the default groups of that role, e.g. controlplane=masters",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "write to this file instead of stdout",
+			},
+		},
+		Action: importInventory,
+	}
+}
+
+func newConfigCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "config",
+		Description: "create and inspect config files",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "init",
+				Description: "ask for nodes, roles, vip, registry, ntp and nfs and write a commented config file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "path of the config file to write",
+						Value: "config.yml",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "overwrite an existing file",
+					},
+					&cli.BoolFlag{
+						Name:  "no-probe",
+						Usage: "do not offer to verify the nodes over SSH",
+					},
+				},
+				Action: initConfig,
+			},
+			{
+				Name:        "schema",
+				Description: "print the JSON Schema of the config file, for editors and CI",
+				Action:      printSchema,
+			},
+		},
+	}
+}
+
+func newWebCmd(ctx context.Context) *cli.Command {
+	return &cli.Command{
+		Name:        "serve",
+		Description: "start the server exposing the install API",
+		Flags:       serveFlags(),
+		Action:      serve,
+		Subcommands: []*cli.Command{
+			{
+				Name:        "passwd",
+				Description: "read a password from stdin and print its bcrypt hash for the auth file",
+				Action:      hashPassword,
+			},
+		},
+	}
+}
+
+func serveFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "addr",
+			Usage: "address the server listens on",
+			Value: ":8080",
+		},
+		&cli.StringFlag{
+			Name:  "db",
+			Usage: "path to the database keeping clusters and job history",
+			Value: "k8s-tool.db",
+		},
+		&cli.StringFlag{
+			Name:  "auth",
+			Usage: "path to the file with users and tokens",
+			Value: "auth.yml",
+		},
+		&cli.BoolFlag{
+			Name:  "no-auth",
+			Usage: "disable authentication, every caller is an admin",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "path to the TLS certificate",
+		},
+		&cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "path to the TLS private key",
+		},
+	}
+}
+
+func serve(ctx *cli.Context) error {
+	var auth *server.Auth
+	if !ctx.Bool("no-auth") {
+		var err error
+		auth, err = server.LoadAuth(ctx.String("auth"))
+		if err != nil {
+			return fmt.Errorf("load auth config (use --no-auth to disable authentication): %w", err)
+		}
+	}
+	st, err := store.Open(ctx.String("db"))
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	s, err := server.New(
+		server.Addr(ctx.String("addr")),
+		server.Store(st),
+		server.WithAuth(auth),
+		server.TLS(ctx.String("tls-cert"), ctx.String("tls-key")),
+	)
+	if err != nil {
+		return err
+	}
+	sigCtx, stop := signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return s.Run(sigCtx)
+}
+
+func hashPassword(ctx *cli.Context) error {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return errors.New("password is empty")
+	}
+	hash, err := server.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
 func install(ctx *cli.Context) error {
 	if ctx.Bool("steps") {
-		printSteps()
+		printSteps(installSteps(ctx))
 		return nil
 	}
-	config.MustLoad(ctx.String("config"))
-	c := config.C
-
-	e, err := engine.New(
-		engine.Namespace(c.Namespace),
-		engine.CRISocket(c.CRISocket),
-		engine.Registry(c.Registry),
-		engine.Vip(c.Vip),
-		engine.Region(c.Region),
-		engine.NTP(c.NTP.Server, c.NTP.Allow, c.NTP.Timezone),
-		engine.NFS(c.NFS.Server, c.NFS.Path),
-	)
+	sel, err := selector(ctx)
 	if err != nil {
 		return err
 	}
-	for _, nn := range c.Nodes {
-		n, err := node.New(
-			node.Address(nn.Address),
-			node.Role(nn.Role),
-			node.Port(nn.Port),
-			node.Username(nn.Username),
-			node.Password(nn.Password),
-			node.KeyPath(nn.KeyPath),
-		)
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+	if path := ctx.String("inventory"); path != "" {
+		groups, err := inventoryGroups(ctx)
 		if err != nil {
 			return err
 		}
-		n.SetHostname(nn.Hostname)
-		if err := e.AddNode(n); err != nil {
+		if config.C.Nodes, err = config.ImportInventory(path, "", groups); err != nil {
 			return err
 		}
+		config.C.NodeGroups = nil
+	}
+
+	e, err := engine.FromConfig(config.C, nil, engine.Nodes(sel))
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("dry-run") {
+		return dryRun(e)
 	}
-	if ctx.Bool("update") {
+	switch {
+	case ctx.Bool("reset"):
+		return e.Reset(ctx.String("step"))
+	case ctx.Bool("update"):
 		return e.Update(ctx.String("step"))
 	}
 	return e.Install(ctx.String("step"))
 }
 
-func printSteps() {
-	for _, i := range engine.DeploySteps {
+func dryRun(e *engine.Engine) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	data, err := e.KubeadmConfig()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "config is valid, kubeadm config:")
+	os.Stdout.Write(data)
+	return nil
+}
+
+func upgrade(ctx *cli.Context) error {
+	if ctx.Bool("steps") {
+		printSteps(engine.UpgradeSteps)
+		return nil
+	}
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	e, err := engine.FromConfig(config.C, nil, engine.UpgradeBatch(ctx.Int("batch")))
+	if err != nil {
+		return err
+	}
+	return e.Upgrade(ctx.String("step"))
+}
+
+func backupEtcd(ctx *cli.Context) error {
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	path, err := e.BackupEtcd(ctx.String("dir"), ctx.Int("keep"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
+
+func restoreEtcd(ctx *cli.Context) error {
+	if ctx.Bool("steps") {
+		printSteps(engine.RestoreSteps)
+		return nil
+	}
+	snapshot := ctx.String("snapshot")
+	if snapshot == "" {
+		return errors.New("--snapshot is required")
+	}
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	if !ctx.Bool("yes") {
+		fmt.Fprintf(os.Stderr, "Restoring %s replaces the etcd data of every control plane node, steps:\n", snapshot)
+		printSteps(engine.RestoreSteps)
+		fmt.Fprint(os.Stderr, "Type yes to continue: ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(line) != "yes" {
+			return errors.New("restore aborted")
+		}
+	}
+	return e.RestoreEtcd(snapshot, ctx.String("step"))
+}
+
+func checkCerts(ctx *cli.Context) error {
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	certs, err := e.CheckCerts()
+	if err != nil {
+		return err
+	}
+	warn := time.Now().AddDate(0, 0, ctx.Int("warn"))
+	var rows [][]string
+	for _, c := range certs {
+		status := "ok"
+		switch {
+		case c.Expires.Before(time.Now()):
+			status = "EXPIRED"
+		case c.Expires.Before(warn):
+			status = "EXPIRING"
+		}
+		name := c.Name
+		if c.Authority {
+			name += " (ca)"
+		}
+		rows = append(rows, []string{c.Node, name, c.Expires.Format("2006-01-02 15:04 MST"), c.Residual, status})
+	}
+	printTable([]string{"NODE", "CERTIFICATE", "EXPIRES", "RESIDUAL", "STATUS"}, rows)
+	return nil
+}
+
+func renewCerts(ctx *cli.Context) error {
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	return e.RenewCerts()
+}
+
+func kubeconfig(ctx *cli.Context) error {
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	name := ctx.String("name")
+	var data []byte
+	if user := ctx.String("user"); user != "" {
+		if ctx.Duration("expiration") < 10*time.Minute {
+			return errors.New("--expiration must be at least 10m")
+		}
+		data, err = e.UserKubeconfig(name, user, ctx.StringSlice("group"), ctx.String("clusterrole"), ctx.Duration("expiration"))
+	} else {
+		data, err = e.AdminKubeconfig(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ctx.Bool("merge"):
+		path := os.Getenv("KUBECONFIG")
+		if path != "" {
+			path = filepath.SplitList(path)[0]
+		} else {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			path = filepath.Join(home, ".kube", "config")
+		}
+		if err := engine.MergeKubeconfig(path, data); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "merged cluster %s into %s\n", name, path)
+	case ctx.String("output") != "":
+		return os.WriteFile(ctx.String("output"), data, 0o600)
+	default:
+		os.Stdout.Write(data)
+	}
+	return nil
+}
+
+func status(ctx *cli.Context) error {
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	st, err := e.Status()
+	if err != nil {
+		return err
+	}
+	mark := func(ok bool) string {
+		if ok {
+			return " "
+		}
+		return "!"
+	}
+	var rows [][]string
+	for _, n := range st.Nodes {
+		rows = append(rows, []string{mark(len(n.Drift) == 0), n.Name, n.Address, strconv.FormatBool(n.Ready),
+			strings.Join(n.Roles, ","), n.KubeletVersion, strings.Join(n.Drift, "; ")})
+	}
+	printTable([]string{"", "NODE", "ADDRESS", "READY", "ROLES", "KUBELET", "DRIFT"}, rows)
+
+	rows = nil
+	for _, p := range st.ControlPlane {
+		rows = append(rows, []string{mark(p.Ready), p.Name, p.Node, p.Phase, strconv.FormatBool(p.Ready)})
+	}
+	printTable([]string{"", "CONTROL PLANE POD", "NODE", "PHASE", "READY"}, rows)
+
+	rows = nil
+	for _, wl := range st.Workloads {
+		rows = append(rows, []string{mark(wl.Rolled()), wl.Kind + "/" + wl.Name, wl.Namespace,
+			fmt.Sprintf("%d/%d", wl.Ready, wl.Desired), fmt.Sprintf("%d/%d", wl.Updated, wl.Desired)})
+	}
+	printTable([]string{"", "WORKLOAD", "NAMESPACE", "READY", "UPDATED"}, rows)
+
+	rows = nil
+	for _, p := range st.Probes {
+		rows = append(rows, []string{mark(p.OK), p.Check, p.Node, p.State})
+	}
+	printTable([]string{"", "CHECK", "NODE", "STATE"}, rows)
+
+	if st.Drifted() {
+		fmt.Fprintln(os.Stderr, "the cluster differs from the config, see the DRIFT column")
+	}
+	return nil
+}
+
+func diff(ctx *cli.Context) error {
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	items, err := e.Diff()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Println("the cluster matches the config")
+		return nil
+	}
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, []string{item.Subject, item.Problem, item.Remediation})
+	}
+	printTable([]string{"SUBJECT", "PROBLEM", "REMEDIATION"}, rows)
+	return cli.Exit(fmt.Sprintf("%d differences", len(items)), 1)
+}
+
+func execOnNodes(ctx *cli.Context) error {
+	command := strings.Join(ctx.Args().Slice(), " ")
+	if strings.TrimSpace(command) == "" {
+		return errors.New("command is required")
+	}
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	sel, err := selector(ctx)
+	if err != nil {
+		return err
+	}
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	results, err := e.Exec(sel, command)
+	if err != nil {
+		return err
+	}
+	for _, g := range engine.GroupExecResults(results) {
+		fmt.Println("----------------")
+		fmt.Printf("%s (exit %d)\n", strings.Join(g.Nodes, ","), g.ExitCode)
+		fmt.Println("----------------")
+		fmt.Print(g.Output)
+		if g.Output != "" && !strings.HasSuffix(g.Output, "\n") {
+			fmt.Println()
+		}
+	}
+	failed := 0
+	for _, r := range results {
+		if r.ExitCode != 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return cli.Exit(fmt.Sprintf("failed on %d of %d nodes", failed, len(results)), 1)
+	}
+	return nil
+}
+
+func copyToNodes(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return errors.New("cp needs SRC and DST")
+	}
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	sel, err := selector(ctx)
+	if err != nil {
+		return err
+	}
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	return e.Copy(sel, ctx.Args().Get(0), ctx.Args().Get(1), ctx.String("mode"), ctx.String("owner"))
+}
+
+func fetchFromNodes(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("fetch needs SRC")
+	}
+	if err := config.Load(ctx.String("config")); err != nil {
+		return err
+	}
+
+	sel, err := selector(ctx)
+	if err != nil {
+		return err
+	}
+	e, err := engine.FromConfig(config.C, nil)
+	if err != nil {
+		return err
+	}
+	return e.Fetch(sel, ctx.Args().First(), ctx.String("dir"))
+}
+
+// inventoryGroups builds the role to group mapping from the --group flags
+// on top of the defaults.
+func inventoryGroups(ctx *cli.Context) (map[string][]string, error) {
+	groups := map[string][]string{}
+	for role, names := range config.DefaultInventoryGroups {
+		groups[role] = names
+	}
+	replaced := map[string]bool{}
+	for _, mapping := range ctx.StringSlice("group") {
+		role, group, ok := strings.Cut(mapping, "=")
+		if _, known := groups[role]; !ok || !known || group == "" {
+			return nil, fmt.Errorf("invalid group mapping %q, want etcd|controlplane|worker=GROUP", mapping)
+		}
+		if !replaced[role] {
+			groups[role] = nil
+			replaced[role] = true
+		}
+		groups[role] = append(groups[role], group)
+	}
+	return groups, nil
+}
+
+func importInventory(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("import needs INVENTORY")
+	}
+	groups, err := inventoryGroups(ctx)
+	if err != nil {
+		return err
+	}
+	nodes, err := config.ImportInventory(ctx.Args().First(), ctx.String("format"), groups)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]any{"nodes": nodes}); err != nil {
+		return err
+	}
+	if path := ctx.String("output"); path != "" {
+		return os.WriteFile(path, b.Bytes(), 0o600)
+	}
+	_, err = os.Stdout.Write(b.Bytes())
+	return err
+}
+
+func initConfig(ctx *cli.Context) error {
+	path := ctx.String("output")
+	if _, err := os.Stat(path); err == nil && !ctx.Bool("force") {
+		return fmt.Errorf("%s exists, use --force to overwrite it", path)
+	}
+	w := &config.Wizard{In: bufio.NewReader(os.Stdin), Out: os.Stderr}
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		w.ReadPassword = func() (string, error) {
+			p, err := term.ReadPassword(fd)
+			return string(p), err
+		}
+	}
+	if !ctx.Bool("no-probe") {
+		w.Probe = probeNode
+	}
+	data, err := w.Run()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s, check it with: k8s-tools install --config %s --dry-run\n", path, path)
+	return nil
+}
+
+func printSchema(ctx *cli.Context) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(config.Schema())
+}
+
+// probeNode connects to a node for config init and reports its hostname,
+// os and architecture.
+func probeNode(address string, port uint16, username, password, keyPath string) (config.NodeProbe, error) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	n, err := node.New(
+		node.Address(address),
+		node.Port(port),
+		node.Username(base64.StdEncoding.EncodeToString([]byte(username))),
+		node.Password(base64.StdEncoding.EncodeToString([]byte(password))),
+		node.KeyPath(keyPath),
+		node.Logger(log),
+	)
+	if err != nil {
+		return config.NodeProbe{}, err
+	}
+	if err := n.Connect(); err != nil {
+		return config.NodeProbe{}, err
+	}
+	if closer, ok := n.(interface{ Close() }); ok {
+		defer closer.Close()
+	}
+	out, err := n.Run("", "hostname")
+	if err != nil {
+		return config.NodeProbe{}, err
+	}
+	return config.NodeProbe{Hostname: strings.TrimSpace(string(out)), OS: n.GetOS(), Arch: n.GetArch()}, nil
+}
+
+func printTable(header []string, rows [][]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+func installSteps(ctx *cli.Context) []*engine.Step {
+	switch {
+	case ctx.Bool("reset"):
+		return engine.ResetSteps
+	case ctx.Bool("update"):
+		return engine.UpdateSteps
+	}
+	return engine.DeploySteps
+}
+
+func printSteps(steps []*engine.Step) {
+	for _, i := range steps {
 		fmt.Fprintln(os.Stderr, i.Num, ": ", i.Name)
 	}
 }